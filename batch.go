@@ -0,0 +1,501 @@
+package ingres
+
+/*
+#include <stdlib.h>
+#include <iiapi.h>
+
+static inline IIAPI_DESCRIPTOR * get_batch_desc(IIAPI_DESCRIPTOR *descs, int i)
+{
+    return &descs[i];
+}
+
+static inline IIAPI_DATAVALUE * get_batch_dv(IIAPI_DATAVALUE *cols, int i)
+{
+    return &cols[i];
+}
+*/
+import "C"
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// Batch is a list of statements sent to the server by Send at once with
+// IIapi_batch, which needs Ingres 10 or later. Consecutive statements with
+// the same text share the parameter descriptors. Procedure calls, positioned
+// statements and statements with long values can't be a part of a batch,
+// they are executed separately in their place.
+type Batch struct {
+	conn  *sql.Conn
+	items []batchItem
+}
+
+type batchItem struct {
+	query string
+	args  []any
+}
+
+// BatchResult is the result of a statement of the batch.
+type BatchResult struct {
+	RowsAffected int64
+	Err          error
+}
+
+// NewBatch returns an empty batch for the connection.
+func NewBatch(conn *sql.Conn) *Batch {
+	return &Batch{conn: conn}
+}
+
+// Queue adds the statement to the batch.
+func (b *Batch) Queue(query string, args ...any) {
+	b.items = append(b.items, batchItem{query: query, args: args})
+}
+
+// Len returns the number of queued statements.
+func (b *Batch) Len() int {
+	return len(b.items)
+}
+
+// Send executes the queued statements in the current transaction of the
+// connection and empties the batch. Statements are executed even if some of
+// them fail, the returned error is the error of the first failed statement.
+func (b *Batch) Send(ctx context.Context) ([]BatchResult, error) {
+	items := b.items
+	b.items = nil
+
+	results := make([]BatchResult, len(items))
+	err := b.conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*OpenAPIConn)
+		if !ok {
+			return errors.New("not an Ingres connection")
+		}
+
+		if err := c.acquire("batch"); err != nil {
+			return err
+		}
+		defer c.release()
+
+		var run batchRun
+		defer run.free()
+
+		for i := 0; i < len(items); {
+			j := i + 1
+			for j < len(items) && items[j].query == items[i].query {
+				j++
+			}
+
+			if !run.add(c, items[i:j], results[i:j]) {
+				// statements are executed in the order of the batch
+				c.sendBatch(ctx, run.stmts)
+				run.free()
+
+				for k := i; k < j; k++ {
+					results[k].RowsAffected, results[k].Err = c.execBatchItem(ctx, items[k])
+				}
+			}
+			i = j
+		}
+
+		c.sendBatch(ctx, run.stmts)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for i, res := range results {
+		if res.Err != nil {
+			return results, fmt.Errorf("statement %d: %w", i, res.Err)
+		}
+	}
+	return results, nil
+}
+
+// batchStmt is a statement sent by IIapi_batch
+type batchStmt struct {
+	text   string
+	params *batchParams
+	row    int
+	result *BatchResult
+}
+
+// batchRun is a list of statements sent together
+type batchRun struct {
+	stmts  []batchStmt
+	params []*batchParams
+}
+
+// add adds statements with the same text to the run, it returns false if
+// they should be executed separately
+func (r *batchRun) add(c *OpenAPIConn, items []batchItem, results []BatchResult) bool {
+	text, argRows, err := c.bindBatch(items)
+	if err != nil {
+		return false
+	}
+
+	if params, ok := newBatchParams(argRows, c.params.NVarchar); ok {
+		r.params = append(r.params, params)
+		for i := range items {
+			r.stmts = append(r.stmts, batchStmt{text: text, params: params, row: i, result: &results[i]})
+		}
+		return true
+	}
+
+	// types of the values differ, every statement gets its own descriptors
+	stmts := make([]batchStmt, len(items))
+	params := make([]*batchParams, 0, len(items))
+	for i := range items {
+		p, ok := newBatchParams(argRows[i:i+1], c.params.NVarchar)
+		if !ok {
+			for _, p := range params {
+				p.free()
+			}
+			return false
+		}
+		params = append(params, p)
+		stmts[i] = batchStmt{text: text, params: p, result: &results[i]}
+	}
+
+	r.params = append(r.params, params...)
+	r.stmts = append(r.stmts, stmts...)
+	return true
+}
+
+func (r *batchRun) free() {
+	for _, p := range r.params {
+		p.free()
+	}
+	r.stmts = nil
+	r.params = nil
+}
+
+// execBatchItem executes a statement which can't be a part of a batch
+func (c *OpenAPIConn) execBatchItem(ctx context.Context, item batchItem) (int64, error) {
+	res, err := c.execContext(ctx, item.query, batchNamedValues(item.args))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// sendBatch sends the statements with IIapi_batch and gets their results.
+// If the batch can't be sent, all its statements get the error.
+func (c *OpenAPIConn) sendBatch(ctx context.Context, stmts []batchStmt) {
+	if len(stmts) == 0 {
+		return
+	}
+
+	fail := func(stmts []batchStmt, err error) {
+		for _, st := range stmts {
+			st.result.Err = err
+		}
+	}
+
+	if c.currentTransaction == nil {
+		if err := c.enableAutoCommit(context.Background()); err != nil {
+			fail(stmts, err)
+			return
+		}
+	}
+
+	var stmtHandle C.II_PTR
+	defer func() {
+		_ = closeStmt(stmtHandle)
+	}()
+
+	for _, st := range stmts {
+		var err error
+		stmtHandle, err = c.addBatchStmt(ctx, stmtHandle, st)
+		if err != nil {
+			fail(stmts, err)
+			return
+		}
+	}
+
+	for i, st := range stmts {
+		var getQInfoParm C.IIAPI_GETQINFOPARM
+
+		setCallback(&getQInfoParm.gq_genParm)
+		getQInfoParm.gq_stmtHandle = stmtHandle
+
+		C.IIapi_getQueryInfo(&getQInfoParm)
+		err := waitContext(ctx, &getQInfoParm.gq_genParm, func() {
+			_ = cancelStmt(stmtHandle)
+		})
+		if err != nil {
+			fail(stmts[i:], err)
+			return
+		}
+
+		st.result.Err = checkError("IIapi_getQueryInfo()", &getQInfoParm.gq_genParm)
+		if st.result.Err == nil {
+			st.result.RowsAffected = int64(getQInfoParm.gq_rowCountEx)
+		}
+	}
+}
+
+// addBatchStmt adds the statement to the batch, the first statement starts
+// it and gets the statement handle used by the rest
+func (c *OpenAPIConn) addBatchStmt(ctx context.Context, stmtHandle C.II_PTR, st batchStmt) (C.II_PTR, error) {
+	var batchParm C.IIAPI_BATCHPARM
+
+	setCallback(&batchParm.ba_genParm)
+	batchParm.ba_connHandle = c.handle
+	batchParm.ba_tranHandle = c.currentTransaction.handle
+	batchParm.ba_stmtHandle = stmtHandle
+	batchParm.ba_queryType = C.IIAPI_QT_QUERY
+	batchParm.ba_queryText = C.CString(st.text)
+	defer C.free(unsafe.Pointer(batchParm.ba_queryText))
+	batchParm.ba_parameters = 0
+	if st.params.count > 0 {
+		batchParm.ba_parameters = 1
+	}
+
+	C.IIapi_batch(&batchParm)
+	err := waitContext(ctx, &batchParm.ba_genParm, func() {
+		_ = cancelStmt(batchParm.ba_stmtHandle)
+	})
+	if err != nil {
+		return stmtHandle, err
+	}
+
+	if batchParm.ba_stmtHandle != nil {
+		stmtHandle = batchParm.ba_stmtHandle
+	}
+	if batchParm.ba_tranHandle != nil {
+		c.currentTransaction.handle = batchParm.ba_tranHandle
+	}
+
+	err = checkError("IIapi_batch()", &batchParm.ba_genParm)
+	if err != nil {
+		return stmtHandle, err
+	}
+
+	if st.params.count > 0 {
+		err = st.params.send(ctx, stmtHandle, st.row)
+	}
+	return stmtHandle, err
+}
+
+// bindBatch converts arguments of the statements like ExecContext does, the
+// query text should be the same for all statements
+func (c *OpenAPIConn) bindBatch(items []batchItem) (string, [][]driver.Value, error) {
+	query := items[0].query
+	if _, ok := parseProcCall(query); ok {
+		return "", nil, errors.New("procedures are called one by one")
+	}
+	if _, _, _, ok := parseCurrentOf(query); ok {
+		return "", nil, errors.New("positioned statements are executed one by one")
+	}
+
+	var text string
+	argRows := make([][]driver.Value, len(items))
+
+	for i, item := range items {
+		nvs := batchNamedValues(item.args)
+		for j := range nvs {
+			v, err := c.convertArg(nvs[j].Value)
+			if err != nil {
+				return "", nil, err
+			}
+			nvs[j].Value = v
+		}
+
+		q, vals, err := c.bindArgs(query, nvs)
+		if err != nil {
+			return "", nil, err
+		}
+
+		if i > 0 && q != text {
+			return "", nil, errors.New("statements have different text")
+		}
+		text = q
+		argRows[i] = vals
+	}
+
+	if strings.Contains(text, "~V") {
+		return "", nil, errors.New("values are inlined into the text")
+	}
+	return strings.TrimRight(text, "; "), argRows, nil
+}
+
+func batchNamedValues(args []any) []driver.NamedValue {
+	nvs := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		nvs[i].Ordinal = i + 1
+		nvs[i].Value = arg
+		if named, ok := arg.(sql.NamedArg); ok {
+			nvs[i].Name = named.Name
+			nvs[i].Value = named.Value
+		}
+	}
+	return nvs
+}
+
+// batchParams are parameter descriptors shared by the statements and the
+// values of every statement
+type batchParams struct {
+	descs *C.IIAPI_DESCRIPTOR
+	cols  *C.IIAPI_DATAVALUE
+	count int
+	vals  [][][]byte // nil for NULL
+}
+
+// newBatchParams makes descriptors which fit the values of all statements:
+// strings are sent as varchar of the longest length. It returns false if
+// there are long values or types of the values differ.
+func newBatchParams(argRows [][]driver.Value, nvarchar bool) (*batchParams, bool) {
+	count := len(argRows[0])
+	descs := make([]C.IIAPI_DESCRIPTOR, count)
+	known := make([]bool, count)
+	nullable := make([]bool, count)
+
+	vals := make([][][]byte, len(argRows))
+	for r, row := range argRows {
+		if len(row) != count {
+			return nil, false
+		}
+		vals[r] = make([][]byte, count)
+
+		for i, arg := range row {
+			if arg == nil {
+				nullable[i] = true
+				continue
+			}
+
+			if str, ok := arg.(string); ok && nvarchar {
+				arg = NString(str)
+			}
+
+			var desc C.IIAPI_DESCRIPTOR
+			if fillLongDesc(&desc, arg) != nil || isStreamArg(arg) {
+				return nil, false
+			}
+
+			val, err := fillDesc(&desc, arg)
+			if err != nil {
+				return nil, false
+			}
+
+			if desc.ds_dataType == C.IIAPI_CHA_TYPE {
+				// varchar allows values of different length
+				vch := make([]byte, len(val)+2)
+				nativeEndian.PutUint16(vch, uint16(len(val)))
+				copy(vch[2:], val)
+				val = vch
+				desc.ds_dataType = C.IIAPI_VCH_TYPE
+				desc.ds_length = C.II_UINT2(len(val))
+			}
+			vals[r][i] = val
+
+			if !known[i] {
+				descs[i] = desc
+				known[i] = true
+				continue
+			}
+
+			prev := &descs[i]
+			if prev.ds_dataType != desc.ds_dataType || prev.ds_precision != desc.ds_precision ||
+				prev.ds_scale != desc.ds_scale {
+				return nil, false
+			}
+
+			if prev.ds_length != desc.ds_length {
+				if !isVarLenType(desc.ds_dataType) {
+					return nil, false
+				}
+				if desc.ds_length > prev.ds_length {
+					prev.ds_length = desc.ds_length
+				}
+			}
+		}
+	}
+
+	p := &batchParams{count: count, vals: vals}
+	if count == 0 {
+		return p, true
+	}
+
+	p.descs = (*C.IIAPI_DESCRIPTOR)(C.malloc(C.size_t(count) * C.size_t(unsafe.Sizeof(C.IIAPI_DESCRIPTOR{}))))
+	p.cols = (*C.IIAPI_DATAVALUE)(C.malloc(C.size_t(count) * C.size_t(unsafe.Sizeof(C.IIAPI_DATAVALUE{}))))
+
+	for i := range descs {
+		if !known[i] {
+			// type doesn't matter for NULL, the server coerces it
+			descs[i].ds_dataType = C.IIAPI_CHA_TYPE
+			descs[i].ds_length = 1
+		}
+
+		desc := C.get_batch_desc(p.descs, C.int(i))
+		*desc = descs[i]
+		desc.ds_columnType = C.IIAPI_COL_QPARM
+		desc.ds_columnName = nil
+		desc.ds_nullable = 0
+		if nullable[i] {
+			desc.ds_nullable = 1
+		}
+	}
+	return p, true
+}
+
+func isVarLenType(dt C.IIAPI_DT_ID) bool {
+	return dt == C.IIAPI_VCH_TYPE || dt == C.IIAPI_NVCH_TYPE || dt == C.IIAPI_VBYTE_TYPE
+}
+
+// send sends the parameters of r-th statement
+func (p *batchParams) send(ctx context.Context, stmtHandle C.II_PTR, r int) error {
+	var descrParm C.IIAPI_SETDESCRPARM
+
+	setCallback(&descrParm.sd_genParm)
+	descrParm.sd_stmtHandle = stmtHandle
+	descrParm.sd_descriptorCount = C.short(p.count)
+	descrParm.sd_descriptor = p.descs
+
+	C.IIapi_setDescriptor(&descrParm)
+	err := waitContext(ctx, &descrParm.sd_genParm, func() {
+		_ = cancelStmt(stmtHandle)
+	})
+	if err != nil {
+		return err
+	}
+	err = checkError("IIapi_setDescriptor()", &descrParm.sd_genParm)
+	if err != nil {
+		return err
+	}
+
+	null := []byte{0}
+	for i, val := range p.vals[r] {
+		dv := C.get_batch_dv(p.cols, C.int(i))
+		if val == nil {
+			dv.dv_null = 1
+			dv.dv_length = 1
+			dv.dv_value = C.II_PTR(unsafe.Pointer(&null[0]))
+			continue
+		}
+
+		dv.dv_null = 0
+		dv.dv_length = C.II_UINT2(len(val))
+		dv.dv_value = nil
+		if len(val) > 0 {
+			dv.dv_value = C.II_PTR(unsafe.Pointer(&val[0]))
+		}
+	}
+
+	return putParms(ctx, stmtHandle, p.cols, p.count, false)
+}
+
+func (p *batchParams) free() {
+	if p.descs != nil {
+		C.free(unsafe.Pointer(p.descs))
+		p.descs = nil
+	}
+	if p.cols != nil {
+		C.free(unsafe.Pointer(p.cols))
+		p.cols = nil
+	}
+}
@@ -0,0 +1,46 @@
+package ingres
+
+import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchNamedValues(t *testing.T) {
+	nvs := batchNamedValues([]any{1, sql.Named("name", "x")})
+	assert.Equal(t, []driver.NamedValue{
+		{Ordinal: 1, Value: 1},
+		{Ordinal: 2, Name: "name", Value: "x"},
+	}, nvs)
+}
+
+func TestNewBatchParams(t *testing.T) {
+	p, ok := newBatchParams([][]driver.Value{
+		{int64(1), "a", nil},
+		{int64(2), "abc", nil},
+		{nil, "", nil},
+	}, false)
+	require.True(t, ok)
+	defer p.free()
+
+	assert.Equal(t, 3, p.count)
+	assert.Nil(t, p.vals[2][0])
+	assert.Equal(t, []byte("abc"), p.vals[1][1][2:])
+	assert.Len(t, p.vals[2][1], 2)
+
+	// types differ
+	_, ok = newBatchParams([][]driver.Value{{int64(1)}, {"1"}}, false)
+	assert.False(t, ok)
+
+	// long values are sent one by one
+	_, ok = newBatchParams([][]driver.Value{{strings.Repeat("x", maxShortParamLen+1)}}, false)
+	assert.False(t, ok)
+
+	_, ok = newBatchParams([][]driver.Value{{bytes.NewReader(nil)}}, false)
+	assert.False(t, ok)
+}
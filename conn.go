@@ -6,9 +6,13 @@ import (
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net/netip"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // Compile time validation that our types implement the expected interfaces
@@ -22,6 +26,10 @@ var (
 	_   driver.ConnPrepareContext = (*OpenAPIConn)(nil)
 	_   driver.StmtExecContext = (*stmt)(nil)
 	_   driver.StmtQueryContext = (*stmt)(nil)
+	_   driver.NamedValueChecker = (*OpenAPIConn)(nil)
+	_   driver.Validator = (*OpenAPIConn)(nil)
+	_   driver.SessionResetter = (*OpenAPIConn)(nil)
+	_   driver.RowsNextResultSet = (*rows)(nil)
 	env *OpenAPIEnv
 )
 
@@ -134,6 +142,49 @@ func parseConnParams(name string) (ConnParams, error) {
 		params.UserName = values.Get("username")
 		params.Password = values.Get("password")
 
+		if values.Has("lobstream") {
+			params.StreamLOBs, err = strconv.ParseBool(values.Get("lobstream"))
+			if err != nil {
+				return ConnParams{}, errors.New("lobstream should be a boolean")
+			}
+		}
+
+		if values.Has("nvarchar") {
+			params.NVarchar, err = strconv.ParseBool(values.Get("nvarchar"))
+			if err != nil {
+				return ConnParams{}, errors.New("nvarchar should be a boolean")
+			}
+		}
+
+		if values.Has("repeat") {
+			params.RepeatQueries, err = strconv.ParseBool(values.Get("repeat"))
+			if err != nil {
+				return ConnParams{}, errors.New("repeat should be a boolean")
+			}
+		}
+
+		if values.Has("multistatements") {
+			params.MultiStatements, err = strconv.ParseBool(values.Get("multistatements"))
+			if err != nil {
+				return ConnParams{}, errors.New("multistatements should be a boolean")
+			}
+		}
+
+		if values.Has("fetchrows") {
+			params.FetchRows, err = strconv.Atoi(values.Get("fetchrows"))
+			if err != nil || params.FetchRows < 1 {
+				return ConnParams{}, errors.New("fetchrows should be a positive integer")
+			}
+		}
+
+		switch values.Get("placeholders") {
+		case "", "question":
+		case "dollar":
+			params.DollarPlaceholders = true
+		default:
+			return ConnParams{}, errors.New("placeholders should be either question or dollar")
+		}
+
 		name = parts[0]
 	}
 
@@ -147,7 +198,28 @@ func makeStmt(c *OpenAPIConn, query string, queryType QueryType) *stmt {
 		conn:      c,
 		query:     strings.TrimRight(query, "; "),
 		queryType: queryType,
+		numInput:  -1,
+	}
+}
+
+// bindArgs rewrites named markers, and $N markers if placeholders=dollar
+// is set, into positional ones. It's done once where the query comes from
+// the caller, the statements below get positional arguments only.
+func (c *OpenAPIConn) bindArgs(query string, args []driver.NamedValue) (string, []driver.Value, error) {
+	query, vals, err := bindNamed(query, args)
+	if err != nil || !c.params.DollarPlaceholders {
+		return query, vals, err
 	}
+	return bindDollar(query, vals)
+}
+
+// namedValues turns positional arguments into named values with ordinals
+func namedValues(args []driver.Value) []driver.NamedValue {
+	res := make([]driver.NamedValue, len(args))
+	for i, v := range args {
+		res[i] = driver.NamedValue{Ordinal: i + 1, Value: v}
+	}
+	return res
 }
 
 func (c *OpenAPIConn) Query(query string, args []driver.Value) (driver.Rows, error) {
@@ -161,22 +233,78 @@ func (c *OpenAPIConn) Exec(query string, args []driver.Value) (driver.Result, er
 }
 
 func (c *OpenAPIConn) Prepare(query string) (driver.Stmt, error) {
-	return makeStmt(c, query, QUERY), nil
+	return c.PrepareContext(context.Background(), query)
 }
 
+// PrepareContext prepares the statement on the server, statements which
+// can't be prepared, like procedure calls and cursors, send the query text
+// on every execution.
 func (c *OpenAPIConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-	return c.Prepare(query)
+
+	if err := c.acquire("prepare"); err != nil {
+		return nil, err
+	}
+	defer c.release()
+
+	s := makeStmt(c, query, QUERY)
+	if err := s.prepare(ctx); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
 func (c *OpenAPIConn) Begin() (driver.Tx, error) {
 	return c.BeginTx(context.Background(), driver.TxOptions{})
 }
 
+// Close disconnects, the connection can't be used after that.
 func (c *OpenAPIConn) Close() error {
-	return disconnect(c)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.handle == nil {
+		return nil
+	}
+
+	c.state = ConnBroken
+	err := disconnect(c)
+	if err == nil {
+		c.handle = nil
+	}
+	return err
+}
+
+// beginStatement returns the statement which starts a transaction with the
+// options. Ingres sets them by "set transaction", which should be the first
+// statement of the transaction.
+func beginStatement(opts driver.TxOptions) (string, error) {
+	var modes []string
+
+	switch level := sql.IsolationLevel(opts.Isolation); level {
+	case sql.LevelDefault:
+	case sql.LevelReadUncommitted:
+		modes = append(modes, "isolation level read uncommitted")
+	case sql.LevelReadCommitted:
+		modes = append(modes, "isolation level read committed")
+	case sql.LevelRepeatableRead:
+		modes = append(modes, "isolation level repeatable read")
+	case sql.LevelSerializable:
+		modes = append(modes, "isolation level serializable")
+	default:
+		return "", fmt.Errorf("isolation level %s is not supported", level)
+	}
+
+	if opts.ReadOnly {
+		modes = append(modes, "read only")
+	}
+
+	if len(modes) == 0 {
+		return "begin transaction", nil
+	}
+	return "set transaction " + strings.Join(modes, ", "), nil
 }
 
 func isBadConnError(err error) bool {
@@ -193,47 +321,173 @@ func isBadConnError(err error) bool {
 		strings.Contains(msg, "invalid sequence")
 }
 
-func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
-	vals := make([]driver.Value, len(args))
-	for i, arg := range args {
-		if arg.Name != "" {
-			return nil, fmt.Errorf("named parameters are not supported")
-		}
-		vals[i] = arg.Value
+// CheckNamedValue passes through the values fillDesc binds natively and
+// leaves everything else to the default database/sql conversion.
+func (c *OpenAPIConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if addr, ok := nv.Value.(IPAddr); ok {
+		nv.Value = addr.Addr
+	}
+
+	switch nv.Value.(type) {
+	case time.Duration, YearMonthInterval, Decimal, UUID, netip.Addr,
+		uint, uint8, uint16, uint32, uint64, LOBStream, NString:
+		return nil
+	case driver.Valuer:
+		// values that know how to convert themselves
+		return driver.ErrSkip
+	case io.Reader:
+		return nil
+	case sql.Out:
+		// BYREF parameters of procedures
+		return nil
 	}
-	return vals, nil
+	return driver.ErrSkip
 }
 
 func (c *OpenAPIConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
-	vals, err := namedValuesToValues(args)
+	if err := c.acquire("exec"); err != nil {
+		return nil, err
+	}
+	defer c.release()
+
+	return c.execContext(ctx, query, args)
+}
+
+// execContext is ExecContext of acquired connection
+func (c *OpenAPIConn) execContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if call, ok := parseProcCall(query); ok {
+		return c.execProc(ctx, call, args)
+	}
+
+	query, vals, err := c.bindArgs(query, args)
 	if err != nil {
 		return nil, err
 	}
 
+	if _, _, _, ok := parseCurrentOf(query); ok {
+		return c.execCurrentOf(ctx, query, vals)
+	}
+
 	s := makeStmt(c, query, EXEC)
 	return s.execCtx(ctx, vals)
 }
 
 func (c *OpenAPIConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
-	vals, err := namedValuesToValues(args)
+	if err := c.acquire("query"); err != nil {
+		return nil, err
+	}
+	defer c.release()
+
+	res, err := c.queryContext(ctx, query, args)
+	if err == nil {
+		c.beginQuery(res)
+	}
+	return res, err
+}
+
+// queryContext is QueryContext of acquired connection
+func (c *OpenAPIConn) queryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if call, ok := parseProcCall(query); ok {
+		return c.queryProc(ctx, call, args)
+	}
+
+	query, vals, err := c.bindArgs(query, args)
 	if err != nil {
 		return nil, err
 	}
 
+	if name, text, ok := parseDeclareCursor(query); ok {
+		return c.queryCursor(ctx, name, text, vals)
+	}
+
+	if c.isMultiQuery(query) {
+		return c.queryMulti(ctx, query, vals)
+	}
+
 	s := makeStmt(c, query, QUERY)
 	return s.queryCtx(ctx, vals)
 }
 
+// isMultiQuery reports whether the query has several statements to be
+// executed by queryMulti, it's done only with multistatements parameter
+// because bodies of procedures and rules contain semicolons too
+func (c *OpenAPIConn) isMultiQuery(query string) bool {
+	return c.params.MultiStatements && len(splitStatements(query)) > 1
+}
+
+// queryMulti executes the first statement of the combined query, others
+// are executed by NextResultSet. The arguments are divided between the
+// statements by their parameter markers.
+func (c *OpenAPIConn) queryMulti(ctx context.Context, query string, args []driver.Value) (driver.Rows, error) {
+	var pending []pendingQuery
+	for _, part := range splitStatements(query) {
+		n := countMarkers(part)
+		if n > len(args) {
+			return nil, errors.New("not enough arguments for the statements")
+		}
+
+		pending = append(pending, pendingQuery{query: part, args: args[:n]})
+		args = args[n:]
+	}
+
+	if len(args) > 0 {
+		return nil, errors.New("more arguments provided than the statements take")
+	}
+
+	res, err := c.runPending(ctx, pending[0])
+	if err != nil {
+		return nil, err
+	}
+
+	res.pending = pending[1:]
+	return res, nil
+}
+
 func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
-	return s.execCtx(context.Background(), args)
+	if err := s.conn.acquire("exec"); err != nil {
+		return nil, err
+	}
+	defer s.conn.release()
+
+	return s.execNamed(context.Background(), namedValues(args))
 }
 
 func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
-	vals, err := namedValuesToValues(args)
+	if err := s.conn.acquire("exec"); err != nil {
+		return nil, err
+	}
+	defer s.conn.release()
+
+	return s.execNamed(ctx, args)
+}
+
+// execNamed is ExecContext of acquired connection
+func (s *stmt) execNamed(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if call, ok := parseProcCall(s.query); ok {
+		return s.conn.execProc(ctx, call, args)
+	}
+
+	query, vals, err := s.conn.bindArgs(s.query, args)
 	if err != nil {
 		return nil, err
 	}
-	return s.execCtx(ctx, vals)
+
+	if _, _, _, ok := parseCurrentOf(query); ok {
+		return s.conn.execCurrentOf(ctx, query, vals)
+	}
+	return s.withQuery(query).execCtx(ctx, vals)
+}
+
+// withQuery returns statement with rewritten query text, the statement
+// itself is kept as it was prepared
+func (s *stmt) withQuery(query string) *stmt {
+	if query == s.query {
+		return s
+	}
+
+	res := *s
+	res.query = query
+	return &res
 }
 
 func (s *stmt) execCtx(ctx context.Context, args []driver.Value) (driver.Result, error) {
@@ -250,10 +504,10 @@ func (s *stmt) execCtx(ctx context.Context, args []driver.Value) (driver.Result,
 	}
 
 	if s.conn.currentTransaction == nil {
-		err = s.conn.AutoCommit()
+		err = s.conn.enableAutoCommit(context.Background())
 		if err != nil {
 			if isBadConnError(err) {
-				return nil, driver.ErrBadConn
+				return nil, s.conn.badConn()
 			}
 			return nil, err
 		}
@@ -262,7 +516,7 @@ func (s *stmt) execCtx(ctx context.Context, args []driver.Value) (driver.Result,
 	rows, err = s.runQuery(ctx, s.conn.currentTransaction.handle)
 	if err != nil {
 		if autocommitMode && isBadConnError(err) {
-			return nil, driver.ErrBadConn
+			return nil, s.conn.badConn()
 		}
 		return nil, err
 	}
@@ -271,7 +525,7 @@ func (s *stmt) execCtx(ctx context.Context, args []driver.Value) (driver.Result,
 	if err != nil {
 		_ = rows.CloseContext(context.Background())
 		if autocommitMode && isBadConnError(err) {
-			return nil, driver.ErrBadConn
+			return nil, s.conn.badConn()
 		}
 		return nil, err
 	}
@@ -279,7 +533,7 @@ func (s *stmt) execCtx(ctx context.Context, args []driver.Value) (driver.Result,
 	err = rows.CloseContext(ctx)
 	if err != nil {
 		if autocommitMode && isBadConnError(err) {
-			return nil, driver.ErrBadConn
+			return nil, s.conn.badConn()
 		}
 		return nil, err
 	}
@@ -288,15 +542,50 @@ func (s *stmt) execCtx(ctx context.Context, args []driver.Value) (driver.Result,
 }
 
 func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
-	return s.queryCtx(context.Background(), args)
+	if err := s.conn.acquire("query"); err != nil {
+		return nil, err
+	}
+	defer s.conn.release()
+
+	res, err := s.queryNamed(context.Background(), namedValues(args))
+	if err == nil {
+		s.conn.beginQuery(res)
+	}
+	return res, err
 }
 
 func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
-	vals, err := namedValuesToValues(args)
+	if err := s.conn.acquire("query"); err != nil {
+		return nil, err
+	}
+	defer s.conn.release()
+
+	res, err := s.queryNamed(ctx, args)
+	if err == nil {
+		s.conn.beginQuery(res)
+	}
+	return res, err
+}
+
+// queryNamed is QueryContext of acquired connection
+func (s *stmt) queryNamed(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if call, ok := parseProcCall(s.query); ok {
+		return s.conn.queryProc(ctx, call, args)
+	}
+
+	query, vals, err := s.conn.bindArgs(s.query, args)
 	if err != nil {
 		return nil, err
 	}
-	return s.queryCtx(ctx, vals)
+
+	if name, text, ok := parseDeclareCursor(query); ok {
+		return s.conn.queryCursor(ctx, name, text, vals)
+	}
+
+	if s.conn.isMultiQuery(query) {
+		return s.conn.queryMulti(ctx, query, vals)
+	}
+	return s.withQuery(query).queryCtx(ctx, vals)
 }
 
 func (s *stmt) queryCtx(ctx context.Context, args []driver.Value) (driver.Rows, error) {
@@ -308,10 +597,10 @@ func (s *stmt) queryCtx(ctx context.Context, args []driver.Value) (driver.Rows,
 	s.args = args
 
 	if s.conn.currentTransaction == nil {
-		err := s.conn.AutoCommit()
+		err := s.conn.enableAutoCommit(context.Background())
 		if err != nil {
 			if isBadConnError(err) {
-				return nil, driver.ErrBadConn
+				return nil, s.conn.badConn()
 			}
 			return nil, err
 		}
@@ -320,38 +609,52 @@ func (s *stmt) queryCtx(ctx context.Context, args []driver.Value) (driver.Rows,
 
 	rows, err := s.runQuery(ctx, s.conn.currentTransaction.handle)
 	if err != nil && autocommitMode && isBadConnError(err) {
-		return nil, driver.ErrBadConn
+		return nil, s.conn.badConn()
 	}
 
 	return rows, err
 }
 
 func (s *stmt) NumInput() int {
-	return -1
+	return s.numInput
 }
 
 func (t *OpenAPITransaction) Commit() error {
+	if err := t.conn.acquireTx("commit", t); err != nil {
+		return err
+	}
+	defer t.conn.release()
+
 	if t.handle == nil {
 		t.conn.currentTransaction = nil
+		t.conn.endTransaction()
 		return nil
 	}
 
 	err := commitTransaction(t.handle)
 	if err == nil {
 		t.conn.currentTransaction = nil
+		t.conn.endTransaction()
 	}
 	return err
 }
 
 func (t *OpenAPITransaction) Rollback() error {
+	if err := t.conn.acquireTx("rollback", t); err != nil {
+		return err
+	}
+	defer t.conn.release()
+
 	if t.handle == nil {
 		t.conn.currentTransaction = nil
+		t.conn.endTransaction()
 		return nil
 	}
 
 	err := rollbackTransaction(t.handle)
 	if err == nil {
 		t.conn.currentTransaction = nil
+		t.conn.endTransaction()
 	}
 	return err
 }
@@ -0,0 +1,66 @@
+package ingres
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertAssign(t *testing.T) {
+	var s string
+	require.NoError(t, convertAssign(&s, int32(42)))
+	assert.Equal(t, "42", s)
+
+	ts := time.Date(2006, 12, 15, 9, 30, 55, 0, time.UTC)
+	require.NoError(t, convertAssign(&s, ts))
+	assert.Equal(t, "2006-12-15T09:30:55Z", s)
+
+	// decimals are returned as strings
+	var f float64
+	require.NoError(t, convertAssign(&f, "1234.50"))
+	assert.Equal(t, 1234.5, f)
+
+	var i int
+	require.NoError(t, convertAssign(&i, "17"))
+	assert.Equal(t, 17, i)
+	assert.Error(t, convertAssign(&i, nil))
+	assert.Error(t, convertAssign(&i, "x"))
+
+	var i8 int8
+	assert.Error(t, convertAssign(&i8, int64(1000)))
+
+	// byte slices don't refer to the buffers of the row
+	buf := []byte("abc")
+	var b []byte
+	var a any
+	require.NoError(t, convertAssign(&b, buf))
+	require.NoError(t, convertAssign(&a, buf))
+	buf[0] = 'x'
+	assert.Equal(t, []byte("abc"), b)
+	assert.Equal(t, []byte("abc"), a)
+
+	var ok bool
+	require.NoError(t, convertAssign(&ok, "true"))
+	assert.True(t, ok)
+
+	var p *int
+	require.NoError(t, convertAssign(&p, int64(5)))
+	require.NotNil(t, p)
+	assert.Equal(t, 5, *p)
+	require.NoError(t, convertAssign(&p, nil))
+	assert.Nil(t, p)
+
+	var ns sql.NullString
+	require.NoError(t, convertAssign(&ns, nil))
+	assert.False(t, ns.Valid)
+
+	var d Decimal
+	require.NoError(t, convertAssign(&d, "12.340"))
+	assert.Equal(t, 3, d.Scale())
+
+	assert.Error(t, convertAssign(&ts, "x"))
+	assert.Error(t, convertAssign(i, int64(1)))
+}
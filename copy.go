@@ -0,0 +1,606 @@
+package ingres
+
+/*
+#include <stdlib.h>
+#include <iiapi.h>
+
+static inline IIAPI_DESCRIPTOR * get_copy_desc(IIAPI_COPYMAP *copyMap, int i)
+{
+    return &copyMap->cp_dbmsDescr[i];
+}
+
+static inline IIAPI_DATAVALUE * get_copy_dv(IIAPI_DATAVALUE *cols, int i)
+{
+    return &cols[i];
+}
+
+// converts the value to the type of the table column
+static IIAPI_STATUS convert_value(IIAPI_DESCRIPTOR *src, II_PTR srcVal,
+    II_UINT2 srcLen, IIAPI_DESCRIPTOR *dst, II_PTR dstVal)
+{
+    IIAPI_CONVERTPARM cv;
+
+    cv.cv_srcDesc = *src;
+    cv.cv_srcDesc.ds_nullable = FALSE;
+    cv.cv_srcValue.dv_null = FALSE;
+    cv.cv_srcValue.dv_length = srcLen;
+    cv.cv_srcValue.dv_value = srcVal;
+
+    cv.cv_dstDesc = *dst;
+    cv.cv_dstDesc.ds_nullable = FALSE;
+    cv.cv_dstDesc.ds_columnType = IIAPI_COL_TUPLE;
+    cv.cv_dstDesc.ds_columnName = NULL;
+    cv.cv_dstValue.dv_null = FALSE;
+    cv.cv_dstValue.dv_length = dst->ds_length;
+    cv.cv_dstValue.dv_value = dstVal;
+
+    IIapi_convertData(&cv);
+    return cv.cv_status;
+}
+*/
+import "C"
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"unsafe"
+)
+
+var errCopyClosed = errors.New("copy is closed")
+
+// copyColumn is a column of the table in the copy map
+type copyColumn struct {
+	desc  C.IIAPI_DESCRIPTOR // ds_columnName is not kept
+	name  string
+	index int // of the value in rows, -1 if the column is not copied
+}
+
+func (col *copyColumn) isLong() bool {
+	cd := columnDesc{ingDataType: col.desc.ds_dataType}
+	return cd.isLongType()
+}
+
+// CopyWriter loads rows into a table, it's returned by CopyIn. The rows are
+// committed when Close is called, the copy is cancelled if writing of a row
+// fails.
+type CopyWriter struct {
+	conn    *sql.Conn
+	rs      *rows
+	columns []copyColumn
+	count   int // of values in a row
+	written int64
+	err     error
+}
+
+// CopyIn starts loading of rows into the table with COPY ... FROM PROGRAM.
+// The rows contain values of the columns in the given order, if columns are
+// empty all columns of the table are loaded in the table order. Columns not
+// in the list are loaded as NULL.
+func CopyIn(ctx context.Context, conn *sql.Conn, table string, columns []string) (*CopyWriter, error) {
+	if !isTableName(table) {
+		return nil, fmt.Errorf("invalid table name %q", table)
+	}
+
+	cw := &CopyWriter{conn: conn}
+
+	err := conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*OpenAPIConn)
+		if !ok {
+			return errors.New("not an Ingres connection")
+		}
+
+		if err := c.acquire("copy"); err != nil {
+			return err
+		}
+		defer c.release()
+
+		rs, err := makeStmt(c, "", EXEC).startCopy(ctx, fmt.Sprintf("copy table %s () from program", table))
+		if err != nil {
+			return err
+		}
+
+		cw.rs = rs
+		cw.columns, err = getCopyMap(ctx, rs.stmtHandle)
+		if err == nil {
+			cw.count, err = mapCopyColumns(cw.columns, columns)
+		}
+		if err == nil {
+			err = checkNotLoaded(cw.columns)
+		}
+		if err != nil {
+			_ = cancelStmt(rs.stmtHandle)
+			_ = rs.CloseContext(ctx)
+			return err
+		}
+
+		// the copy holds the connection until Close or Abort
+		c.beginQuery(rs)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cw, nil
+}
+
+// isTableName reports whether the text is a table name, possibly qualified
+// by the schema: regular or delimited identifiers separated by a dot
+func isTableName(table string) bool {
+	for part := 0; part < 2; part++ {
+		if table == "" {
+			return false
+		}
+
+		end := 0
+		if table[0] == '"' {
+			end = skipQuoted(table, 0)
+			if end < 3 || table[end-1] != '"' {
+				return false
+			}
+			// unterminated identifiers end with an escaped quote
+			if strings.Contains(strings.ReplaceAll(table[1:end-1], `""`, ""), `"`) {
+				return false
+			}
+		} else {
+			if !isIdentStart(table[0]) {
+				return false
+			}
+			for end < len(table) && isIdentChar(table[end]) {
+				end++
+			}
+		}
+
+		if end == len(table) {
+			return true
+		}
+		if table[end] != '.' {
+			return false
+		}
+		table = table[end+1:]
+	}
+	return false
+}
+
+// startCopy runs copy statement in the current transaction
+func (s *stmt) startCopy(ctx context.Context, query string) (*rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if s.conn.currentTransaction == nil {
+		if err := s.conn.enableAutoCommit(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.startQuery(ctx, s.conn.currentTransaction.handle, queryRequest{
+		text:      query,
+		queryType: QUERY,
+	})
+}
+
+// getCopyMap gets descriptors of the table columns
+func getCopyMap(ctx context.Context, stmtHandle C.II_PTR) ([]copyColumn, error) {
+	var copyMapParm C.IIAPI_GETCOPYMAPPARM
+
+	setCallback(&copyMapParm.gm_genParm)
+	copyMapParm.gm_stmtHandle = stmtHandle
+
+	C.IIapi_getCopyMap(&copyMapParm)
+	err := waitContext(ctx, &copyMapParm.gm_genParm, func() {
+		_ = cancelStmt(stmtHandle)
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = checkError("IIapi_getCopyMap()", &copyMapParm.gm_genParm)
+	if err != nil {
+		return nil, err
+	}
+
+	copyMap := &copyMapParm.gm_copyMap
+	res := make([]copyColumn, copyMap.cp_dbmsCount)
+
+	for i := range res {
+		desc := C.get_copy_desc(copyMap, C.int(i))
+		res[i].desc = *desc
+		res[i].desc.ds_columnName = nil
+		res[i].name = strings.TrimSpace(C.GoString(desc.ds_columnName))
+		res[i].index = -1
+	}
+	return res, nil
+}
+
+// mapCopyColumns sets positions of the values in rows, returns the number
+// of values in a row
+func mapCopyColumns(cols []copyColumn, names []string) (int, error) {
+	if len(names) == 0 {
+		for i := range cols {
+			cols[i].index = i
+		}
+		return len(cols), nil
+	}
+
+	for i, name := range names {
+		id, ok := normalizeIdent(name)
+		if !ok {
+			return 0, fmt.Errorf("invalid column name %q", name)
+		}
+
+		found := false
+		for j := range cols {
+			if cols[j].name == id {
+				if cols[j].index >= 0 {
+					return 0, fmt.Errorf("column %s is listed twice", name)
+				}
+				cols[j].index = i
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return 0, fmt.Errorf("there is no column %s in the table", name)
+		}
+	}
+
+	return len(names), nil
+}
+
+// checkNotLoaded checks that columns which are not loaded could be NULL
+func checkNotLoaded(cols []copyColumn) error {
+	for _, col := range cols {
+		if col.index < 0 && col.desc.ds_nullable == 0 {
+			return fmt.Errorf("column %s is not nullable and should be loaded", col.name)
+		}
+	}
+	return nil
+}
+
+// WriteRow sends the row, values are converted to the types of the columns.
+func (cw *CopyWriter) WriteRow(ctx context.Context, values ...any) error {
+	if cw.rs == nil {
+		return errCopyClosed
+	}
+	if cw.err != nil {
+		return cw.err
+	}
+
+	if len(values) != cw.count {
+		return fmt.Errorf("the row has %d values, but %d columns are loaded", len(values), cw.count)
+	}
+
+	err := cw.conn.Raw(func(driverConn any) error {
+		c := driverConn.(*OpenAPIConn)
+		if err := c.acquireRows("copy", cw.rs); err != nil {
+			return err
+		}
+		defer c.release()
+
+		return cw.putRow(ctx, c, values)
+	})
+	if err != nil {
+		// the server has a part of the row
+		cw.err = err
+		return err
+	}
+
+	cw.written++
+	return nil
+}
+
+func (cw *CopyWriter) putRow(ctx context.Context, c *OpenAPIConn, values []any) error {
+	stmtHandle := cw.rs.stmtHandle
+
+	cols := (*C.IIAPI_DATAVALUE)(C.malloc(C.size_t(len(cw.columns)) * C.size_t(unsafe.Sizeof(C.IIAPI_DATAVALUE{}))))
+	defer C.free(unsafe.Pointer(cols))
+
+	vals := make([][]byte, len(cw.columns))
+	long := make([]io.Reader, len(cw.columns))
+
+	for i := range cw.columns {
+		col := &cw.columns[i]
+		dv := C.get_copy_dv(cols, C.int(i))
+
+		var val driver.Value
+		if col.index >= 0 {
+			var err error
+			if val, err = c.convertArg(values[col.index]); err != nil {
+				return fmt.Errorf("column %s: %w", col.name, err)
+			}
+		}
+
+		if val == nil {
+			vals[i] = make([]byte, col.desc.ds_length+1)
+			dv.dv_null = 1
+			dv.dv_length = 0
+			dv.dv_value = C.II_PTR(unsafe.Pointer(&vals[i][0]))
+			continue
+		}
+
+		if col.isLong() {
+			r, err := copyLongValue(col, val)
+			if err != nil {
+				return err
+			}
+			long[i] = r
+			continue
+		}
+
+		var err error
+		if vals[i], err = convertCopyValue(col, val); err != nil {
+			return err
+		}
+		dv.dv_null = 0
+		dv.dv_length = col.desc.ds_length
+		dv.dv_value = C.II_PTR(unsafe.Pointer(&vals[i][0]))
+	}
+
+	// like parameters, runs of short columns are sent in one call and long
+	// columns segment by segment
+	start := 0
+	for i := 0; i <= len(cw.columns); i++ {
+		if i < len(cw.columns) && long[i] == nil {
+			continue
+		}
+
+		if i > start {
+			err := putColumns(ctx, stmtHandle, C.get_copy_dv(cols, C.int(start)), i-start, false)
+			if err != nil {
+				return err
+			}
+		}
+
+		if i < len(cw.columns) {
+			unit := 1
+			if cw.columns[i].desc.ds_dataType == C.IIAPI_LNVCH_TYPE {
+				unit = 2
+			}
+
+			dv := C.get_copy_dv(cols, C.int(i))
+			err := putSegments(stmtHandle, dv, long[i], unit, func(more bool) error {
+				return putColumns(ctx, stmtHandle, dv, 1, more)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		start = i + 1
+	}
+	return nil
+}
+
+// convertCopyValue returns the value in the format of the column
+func convertCopyValue(col *copyColumn, val driver.Value) ([]byte, error) {
+	var src C.IIAPI_DESCRIPTOR
+
+	if str, ok := val.(string); ok && isNationalType(col.desc.ds_dataType) {
+		val = NString(str)
+	}
+
+	srcVal, err := fillDesc(&src, val)
+	if err != nil {
+		return nil, fmt.Errorf("column %s (%T): %w", col.name, val, err)
+	}
+
+	var srcPtr C.II_PTR
+	if len(srcVal) > 0 {
+		srcPtr = C.II_PTR(unsafe.Pointer(&srcVal[0]))
+	}
+
+	res := make([]byte, col.desc.ds_length+1)
+	status := C.convert_value(&src, srcPtr, C.II_UINT2(len(srcVal)), &col.desc,
+		C.II_PTR(unsafe.Pointer(&res[0])))
+	if status != C.IIAPI_ST_SUCCESS {
+		return nil, fmt.Errorf("column %s: can't convert %T to %s", col.name, val,
+			(&columnDesc{ingDataType: col.desc.ds_dataType}).getTypeName())
+	}
+	return res[:col.desc.ds_length], nil
+}
+
+func isNationalType(dt C.IIAPI_DT_ID) bool {
+	return dt == C.IIAPI_NCHA_TYPE || dt == C.IIAPI_NVCH_TYPE || dt == C.IIAPI_LNVCH_TYPE
+}
+
+// copyLongValue returns the reader of the value for long column
+func copyLongValue(col *copyColumn, val driver.Value) (io.Reader, error) {
+	national := col.desc.ds_dataType == C.IIAPI_LNVCH_TYPE
+
+	switch v := val.(type) {
+	case string:
+		if national {
+			return bytes.NewReader(encodeUTF16(v)), nil
+		}
+		return strings.NewReader(v), nil
+	case NString:
+		if national {
+			return bytes.NewReader(encodeUTF16(string(v))), nil
+		}
+		return strings.NewReader(string(v)), nil
+	case []byte:
+		return bytes.NewReader(v), nil
+	case LOBStream:
+		if v.Reader != nil {
+			return v.Reader, nil
+		}
+	case io.Reader:
+		return v, nil
+	}
+	return nil, fmt.Errorf("column %s: unsupported value %T for long column", col.name, val)
+}
+
+func putColumns(ctx context.Context, stmtHandle C.II_PTR, cols *C.IIAPI_DATAVALUE,
+	count int, moreSegments bool) error {
+	var putColParm C.IIAPI_PUTCOLPARM
+
+	setCallback(&putColParm.pc_genParm)
+	putColParm.pc_stmtHandle = stmtHandle
+	putColParm.pc_columnCount = C.short(count)
+	putColParm.pc_columnData = cols
+	putColParm.pc_moreSegments = 0
+	if moreSegments {
+		putColParm.pc_moreSegments = 1
+	}
+
+	C.IIapi_putColumns(&putColParm)
+	err := waitContext(ctx, &putColParm.pc_genParm, func() {
+		_ = cancelStmt(stmtHandle)
+	})
+	if err != nil {
+		return err
+	}
+	return checkError("IIapi_putColumns()", &putColParm.pc_genParm)
+}
+
+// Count returns the number of written rows.
+func (cw *CopyWriter) Count() int64 {
+	return cw.written
+}
+
+// Close completes the copy. If writing of a row failed the copy is
+// cancelled and the error is returned.
+func (cw *CopyWriter) Close(ctx context.Context) error {
+	if cw.rs == nil {
+		return nil
+	}
+
+	return cw.conn.Raw(func(any) error {
+		rs := cw.rs
+		c := rs.stmt.conn
+		if err := c.acquireRows("copy", rs); err != nil {
+			return err
+		}
+		defer c.release()
+
+		cw.rs = nil
+		if cw.err != nil {
+			_ = cancelStmt(rs.stmtHandle)
+			_ = rs.CloseContext(ctx)
+			return cw.err
+		}
+
+		// the server reports errors of the copy in the query info
+		err := rs.fetchInfoContext(ctx)
+		if err != nil {
+			_ = rs.CloseContext(ctx)
+			return err
+		}
+		return rs.CloseContext(ctx)
+	})
+}
+
+// Abort cancels the copy, none of the rows are loaded.
+func (cw *CopyWriter) Abort(ctx context.Context) error {
+	if cw.rs == nil {
+		return nil
+	}
+
+	return cw.conn.Raw(func(any) error {
+		rs := cw.rs
+		c := rs.stmt.conn
+		if err := c.acquireRows("copy", rs); err != nil {
+			return err
+		}
+		defer c.release()
+
+		cw.rs = nil
+		_ = cancelStmt(rs.stmtHandle)
+		return rs.CloseContext(ctx)
+	})
+}
+
+// CopyOut exports rows of the table with COPY ... INTO PROGRAM. fn is called
+// for every row with values of the columns in the given order, if columns
+// are empty all columns are exported in the table order. Values are decoded
+// like values of query results. If fn returns an error the export is
+// cancelled and the error is returned. The number of exported rows is
+// returned.
+func CopyOut(ctx context.Context, conn *sql.Conn, table string, columns []string,
+	fn func(row []driver.Value) error) (int64, error) {
+	if !isTableName(table) {
+		return 0, fmt.Errorf("invalid table name %q", table)
+	}
+
+	var count int64
+
+	err := conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*OpenAPIConn)
+		if !ok {
+			return errors.New("not an Ingres connection")
+		}
+
+		if err := c.acquire("copy"); err != nil {
+			return err
+		}
+		defer c.release()
+
+		rs, err := makeStmt(c, "", QUERY).startCopy(ctx, fmt.Sprintf("copy table %s () into program", table))
+		if err != nil {
+			return err
+		}
+
+		err = rs.copyOut(ctx, c, columns, func(row []driver.Value) error {
+			if err := fn(row); err != nil {
+				return err
+			}
+			count++
+			return nil
+		})
+		if err != nil {
+			_ = cancelStmt(rs.stmtHandle)
+			rs.done = true
+			_ = rs.CloseContext(ctx)
+			return err
+		}
+		return rs.CloseContext(ctx)
+	})
+	return count, err
+}
+
+// copyOut reads rows of the copy statement
+func (rs *rows) copyOut(ctx context.Context, c *OpenAPIConn, columns []string, fn func(row []driver.Value) error) error {
+	cols, err := getCopyMap(ctx, rs.stmtHandle)
+	if err != nil {
+		return err
+	}
+
+	count, err := mapCopyColumns(cols, columns)
+	if err != nil {
+		return err
+	}
+
+	rs.setColumns(len(cols), func(i int) *C.IIAPI_DESCRIPTOR {
+		return &cols[i].desc
+	})
+	for i := range cols {
+		rs.colNames[i] = cols[i].name
+	}
+	rs.colBlocks = rs.makeColBlocks(c.fetchRows(ctx), false)
+
+	values := make([]driver.Value, len(cols))
+	for {
+		err = rs.nextContext(ctx, values)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		row := make([]driver.Value, count)
+		for i, col := range cols {
+			if col.index >= 0 {
+				row[col.index] = values[i]
+			}
+		}
+
+		if err = fn(row); err != nil {
+			return err
+		}
+	}
+}
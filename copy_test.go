@@ -0,0 +1,17 @@
+package ingres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsTableName(t *testing.T) {
+	for _, name := range []string{"items", "_t1", "owner.items", `"My Table"`, `"a""b"`, `owner."x.y"`, `"o".t`} {
+		assert.True(t, isTableName(name), name)
+	}
+
+	for _, name := range []string{"", "1t", "a.b.c", "t; drop table x", "t()", `"open`, `"a""`, `""`, `"`, "t.", ".t", "a b"} {
+		assert.False(t, isTableName(name), name)
+	}
+}
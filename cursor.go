@@ -0,0 +1,299 @@
+package ingres
+
+/*
+#include <iiapi.h>
+*/
+import "C"
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var errCursorClosed = errors.New("cursor is closed")
+
+// CursorOptions are options of OpenCursor.
+type CursorOptions struct {
+	// ForwardOnly opens a cursor which can be read only by Next.
+	ForwardOnly bool
+
+	// Name makes the current row of the cursor available to
+	// "update ... where current of name" and "delete ... where current of
+	// name" statements executed on the same connection.
+	Name string
+}
+
+// Cursor is a server cursor opened with OpenCursor. Rows are fetched one by
+// one at the requested position, the fetch methods return false if there is
+// no row at the position. The cursor should be closed before the connection
+// is returned to the pool.
+type Cursor struct {
+	conn   *sql.Conn
+	rs     *rows
+	scroll bool
+	row    []driver.Value
+}
+
+// OpenCursor opens a cursor for the query. Unlike queries made through
+// database/sql the cursor can be scrolled back and positioned at any row.
+func OpenCursor(ctx context.Context, conn *sql.Conn, query string, opts CursorOptions, args ...any) (*Cursor, error) {
+	cur := &Cursor{conn: conn, scroll: !opts.ForwardOnly}
+
+	err := conn.Raw(func(driverConn any) error {
+		c, ok := driverConn.(*OpenAPIConn)
+		if !ok {
+			return errors.New("not an Ingres connection")
+		}
+
+		if err := c.acquire("cursor"); err != nil {
+			return err
+		}
+		defer c.release()
+
+		vals := make([]driver.Value, len(args))
+		for i, arg := range args {
+			var err error
+			if vals[i], err = c.convertArg(arg); err != nil {
+				return err
+			}
+		}
+
+		name := ""
+		if opts.Name != "" {
+			var ok bool
+			if name, ok = normalizeIdent(opts.Name); !ok {
+				return fmt.Errorf("invalid cursor name %q", opts.Name)
+			}
+			if _, ok = c.cursors[name]; ok {
+				return fmt.Errorf("cursor %s is already open", name)
+			}
+		}
+
+		text, vals, err := c.bindArgs(query, namedValues(vals))
+		if err != nil {
+			return err
+		}
+
+		rs, err := makeStmt(c, text, OPEN).openCursor(ctx, vals, cur.scroll)
+		if err != nil {
+			return err
+		}
+
+		if name != "" {
+			if err = c.registerCursor(name, rs); err != nil {
+				_ = rs.CloseContext(context.Background())
+				return err
+			}
+		}
+
+		cur.rs = rs
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cur, nil
+}
+
+// openCursor opens the cursor like queryCtx runs queries
+func (s *stmt) openCursor(ctx context.Context, args []driver.Value, scroll bool) (*rows, error) {
+	var err error
+
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.queryType = OPEN
+	s.args = args
+
+	if s.conn.currentTransaction == nil {
+		if err = s.conn.enableAutoCommit(context.Background()); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.startQuery(ctx, s.conn.currentTransaction.handle, queryRequest{
+		text:      s.query,
+		queryType: OPEN,
+		sendArgs:  len(args) > 0,
+		describe:  true,
+		scroll:    scroll,
+	})
+}
+
+// Columns returns names of the columns.
+func (cur *Cursor) Columns() []string {
+	if cur.rs == nil {
+		return nil
+	}
+	return cur.rs.colNames
+}
+
+// Next fetches the row after the current one.
+func (cur *Cursor) Next(ctx context.Context) (bool, error) {
+	if !cur.scroll {
+		return cur.fetch(ctx, nil)
+	}
+	return cur.scrollTo(ctx, C.IIAPI_SCROLL_NEXT)
+}
+
+// Prior fetches the row before the current one.
+func (cur *Cursor) Prior(ctx context.Context) (bool, error) {
+	return cur.scrollTo(ctx, C.IIAPI_SCROLL_PRIOR)
+}
+
+// First fetches the first row.
+func (cur *Cursor) First(ctx context.Context) (bool, error) {
+	return cur.scrollTo(ctx, C.IIAPI_SCROLL_FIRST)
+}
+
+// Last fetches the last row.
+func (cur *Cursor) Last(ctx context.Context) (bool, error) {
+	return cur.scrollTo(ctx, C.IIAPI_SCROLL_LAST)
+}
+
+// Absolute fetches n-th row, rows are numbered from 1. Negative n counts
+// from the end: -1 is the last row.
+func (cur *Cursor) Absolute(ctx context.Context, n int) (bool, error) {
+	if n < 0 {
+		return cur.positionAt(ctx, C.IIAPI_POS_END, n)
+	}
+	return cur.positionAt(ctx, C.IIAPI_POS_BEGIN, n)
+}
+
+// Relative fetches the row n rows after the current one, or before it if n
+// is negative.
+func (cur *Cursor) Relative(ctx context.Context, n int) (bool, error) {
+	return cur.positionAt(ctx, C.IIAPI_POS_CURRENT, n)
+}
+
+func (cur *Cursor) scrollTo(ctx context.Context, orientation C.II_UINT2) (bool, error) {
+	if !cur.scroll {
+		return false, errors.New("cursor is forward only")
+	}
+
+	return cur.fetch(ctx, func(stmtHandle C.II_PTR) error {
+		var scrollParm C.IIAPI_SCROLLPARM
+
+		setCallback(&scrollParm.sl_genParm)
+		scrollParm.sl_stmtHandle = stmtHandle
+		scrollParm.sl_orientation = orientation
+		scrollParm.sl_offset = 0
+
+		C.IIapi_scroll(&scrollParm)
+		err := waitContext(ctx, &scrollParm.sl_genParm, func() {
+			_ = cancelStmt(stmtHandle)
+		})
+		if err != nil {
+			return err
+		}
+		return checkError("IIapi_scroll()", &scrollParm.sl_genParm)
+	})
+}
+
+func (cur *Cursor) positionAt(ctx context.Context, reference C.II_UINT2, offset int) (bool, error) {
+	if !cur.scroll {
+		return false, errors.New("cursor is forward only")
+	}
+
+	return cur.fetch(ctx, func(stmtHandle C.II_PTR) error {
+		var posParm C.IIAPI_POSPARM
+
+		setCallback(&posParm.po_genParm)
+		posParm.po_stmtHandle = stmtHandle
+		posParm.po_reference = reference
+		posParm.po_offset = C.II_INT4(offset)
+		posParm.po_rowCount = 1
+
+		C.IIapi_position(&posParm)
+		err := waitContext(ctx, &posParm.po_genParm, func() {
+			_ = cancelStmt(stmtHandle)
+		})
+		if err != nil {
+			return err
+		}
+		return checkError("IIapi_position()", &posParm.po_genParm)
+	})
+}
+
+// fetch moves the cursor with move if it's set and reads the row at the new
+// position
+func (cur *Cursor) fetch(ctx context.Context, move func(stmtHandle C.II_PTR) error) (bool, error) {
+	if cur.rs == nil {
+		return false, errCursorClosed
+	}
+
+	found := false
+	err := cur.conn.Raw(func(any) error {
+		rs := cur.rs
+		cur.row = nil
+
+		if err := rs.stmt.conn.acquireRows("fetch", rs); err != nil {
+			return err
+		}
+		defer rs.stmt.conn.release()
+
+		if move != nil {
+			// the end of rows is not final for scrollable cursors
+			rs.done = false
+			rs.infoFetched = false
+
+			if err := move(rs.stmtHandle); err != nil {
+				return err
+			}
+		}
+
+		row := make([]driver.Value, len(rs.colTyps))
+		err := rs.nextContext(ctx, row)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		cur.row = row
+		found = true
+		return nil
+	})
+	return found, err
+}
+
+// Scan copies the columns of the current row into dest, the values are
+// converted like sql.Rows.Scan does.
+func (cur *Cursor) Scan(dest ...any) error {
+	if cur.row == nil {
+		return errors.New("cursor is not positioned at a row")
+	}
+
+	if len(dest) != len(cur.row) {
+		return errors.New("wrong number of destinations for the cursor row")
+	}
+
+	for i, val := range cur.row {
+		if err := convertAssign(dest[i], val); err != nil {
+			return fmt.Errorf("scan error on column index %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Close closes the cursor.
+func (cur *Cursor) Close(ctx context.Context) error {
+	if cur.rs == nil {
+		return nil
+	}
+
+	return cur.conn.Raw(func(any) error {
+		rs := cur.rs
+		cur.rs = nil
+		cur.row = nil
+
+		// the rest of the rows is not needed
+		rs.done = true
+		return rs.closeConn(ctx)
+	})
+}
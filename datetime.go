@@ -0,0 +1,184 @@
+package ingres
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// Ingres date/time values arrive in the server's internal layout
+// (AD_DATENTRNL, AD_ADATE, AD_TIME and AD_TIMESTAMP in adf.h), in native
+// byte order.
+const (
+	ingresDateLen = 12
+	ansiDateLen   = 4
+	ansiTimeLen   = 10
+	ansiTsLen     = 14
+)
+
+// ingresdate status bits
+const (
+	dnAbsolute = 0x01
+	dnLength   = 0x02
+	dnTimespec = 0x20
+)
+
+type zoneKind int
+
+const (
+	zoneNone  zoneKind = iota // without time zone, wall clock in UTC
+	zoneFixed                 // with time zone, stored as UTC plus offset
+	zoneLocal                 // with local time zone, stored as UTC
+)
+
+var errDateLength = errors.New("unexpected date/time value length")
+
+func zoneLocation(kind zoneKind, tzHour, tzMinute int8) *time.Location {
+	switch kind {
+	case zoneFixed:
+		return time.FixedZone("", int(tzHour)*3600+int(tzMinute)*60)
+	case zoneLocal:
+		return time.Local
+	}
+	return time.UTC
+}
+
+func decodeAnsiDate(val []byte) (time.Time, error) {
+	if len(val) < ansiDateLen {
+		return time.Time{}, errDateLength
+	}
+
+	year := int(int16(nativeEndian.Uint16(val)))
+	return time.Date(year, time.Month(val[2]), int(val[3]), 0, 0, 0, 0, time.UTC), nil
+}
+
+// decodeTime returns time of day on 0000-01-01
+func decodeTime(val []byte, kind zoneKind) (time.Time, error) {
+	if len(val) < ansiTimeLen {
+		return time.Time{}, errDateLength
+	}
+
+	secs := int(int32(nativeEndian.Uint32(val)))
+	nsecs := int(nativeEndian.Uint32(val[4:]))
+	t := time.Date(0, time.January, 1, 0, 0, secs, nsecs, time.UTC)
+
+	if kind == zoneLocal {
+		// year 0 would pick up LMT offsets from the zone database,
+		// use the offset the local zone has today
+		name, offset := time.Now().Zone()
+		return t.In(time.FixedZone(name, offset)), nil
+	}
+	return t.In(zoneLocation(kind, int8(val[8]), int8(val[9]))), nil
+}
+
+func decodeTimestamp(val []byte, kind zoneKind) (time.Time, error) {
+	if len(val) < ansiTsLen {
+		return time.Time{}, errDateLength
+	}
+
+	year := int(int16(nativeEndian.Uint16(val)))
+	secs := int(int32(nativeEndian.Uint32(val[4:])))
+	nsecs := int(nativeEndian.Uint32(val[8:]))
+	t := time.Date(year, time.Month(val[2]), int(val[3]), 0, 0, secs, nsecs, time.UTC)
+
+	return t.In(zoneLocation(kind, int8(val[12]), int8(val[13]))), nil
+}
+
+// encodeTimestamp encodes t as "timestamp with time zone", the instant is
+// kept in UTC with the offset of t's zone.
+func encodeTimestamp(t time.Time) []byte {
+	_, offset := t.Zone()
+	u := t.UTC()
+
+	res := make([]byte, ansiTsLen)
+	nativeEndian.PutUint16(res, uint16(int16(u.Year())))
+	res[2] = byte(u.Month())
+	res[3] = byte(u.Day())
+	nativeEndian.PutUint32(res[4:], uint32(u.Hour()*3600+u.Minute()*60+u.Second()))
+	nativeEndian.PutUint32(res[8:], uint32(u.Nanosecond()))
+	res[12] = byte(int8(offset / 3600))
+	res[13] = byte(int8(offset % 3600 / 60))
+	return res
+}
+
+// decodeIngresDate decodes absolute ingresdate values, ok is false for
+// intervals which have no time.Time representation. Empty dates are
+// returned as zero time.
+func decodeIngresDate(val []byte) (t time.Time, ok bool, err error) {
+	if len(val) < ingresDateLen {
+		return time.Time{}, false, errDateLength
+	}
+
+	status := val[0]
+	if status == 0 {
+		return time.Time{}, true, nil
+	}
+	if status&dnLength != 0 || status&dnAbsolute == 0 {
+		return time.Time{}, false, nil
+	}
+
+	year := int(int16(nativeEndian.Uint16(val[2:])))
+	month := time.Month(int16(nativeEndian.Uint16(val[4:])))
+	day := int(nativeEndian.Uint16(val[6:]))
+
+	if status&dnTimespec == 0 {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC), true, nil
+	}
+
+	// dates with time are kept in GMT and shown in the session time zone
+	msecs := int(int32(nativeEndian.Uint32(val[8:])))
+	t = time.Date(year, month, day, 0, 0, 0, msecs*int(time.Millisecond), time.UTC)
+	return t.In(time.Local), true, nil
+}
+
+const (
+	intervalYMLen = 3
+	intervalDSLen = 12
+)
+
+const oneDay = 24 * time.Hour
+
+var errIntervalRange = errors.New("interval is out of time.Duration range")
+
+func decodeIntervalYM(val []byte) (YearMonthInterval, error) {
+	if len(val) < intervalYMLen {
+		return YearMonthInterval{}, errDateLength
+	}
+
+	years := int(int16(nativeEndian.Uint16(val)))
+	return YearMonthInterval{Years: years, Months: int(int8(val[2]))}, nil
+}
+
+func encodeIntervalYM(i YearMonthInterval) []byte {
+	i = NewYearMonthInterval(i.TotalMonths())
+
+	res := make([]byte, intervalYMLen)
+	nativeEndian.PutUint16(res, uint16(int16(i.Years)))
+	res[2] = byte(int8(i.Months))
+	return res
+}
+
+// decodeIntervalDS decodes AD_INTDS, all three parts have the same sign
+func decodeIntervalDS(val []byte) (time.Duration, error) {
+	if len(val) < intervalDSLen {
+		return 0, errDateLength
+	}
+
+	days := time.Duration(int32(nativeEndian.Uint32(val)))
+	secs := time.Duration(int32(nativeEndian.Uint32(val[4:])))
+	nsecs := time.Duration(int32(nativeEndian.Uint32(val[8:])))
+
+	if days > math.MaxInt64/oneDay || days < math.MinInt64/oneDay {
+		return 0, errIntervalRange
+	}
+	return days*oneDay + secs*time.Second + nsecs, nil
+}
+
+func encodeIntervalDS(d time.Duration) []byte {
+	res := make([]byte, intervalDSLen)
+	nativeEndian.PutUint32(res, uint32(int32(d/oneDay)))
+	d %= oneDay
+	nativeEndian.PutUint32(res[4:], uint32(int32(d/time.Second)))
+	nativeEndian.PutUint32(res[8:], uint32(int32(d%time.Second)))
+	return res
+}
@@ -0,0 +1,101 @@
+package ingres
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeTimestampLayout(t *testing.T) {
+	val := make([]byte, ansiTsLen)
+	nativeEndian.PutUint16(val, 2006)
+	val[2] = 12
+	val[3] = 15
+	nativeEndian.PutUint32(val[4:], 17*3600+30*60+55)
+	nativeEndian.PutUint32(val[8:], 500)
+	val[12] = 0xf8 // -8 hours
+	val[13] = 0
+
+	ts, err := decodeTimestamp(val, zoneFixed)
+	require.NoError(t, err)
+	assert.Equal(t, "2006-12-15 09:30:55-08:00", ts.Format("2006-01-02 15:04:05-07:00"))
+	assert.Equal(t, 500, ts.Nanosecond())
+
+	ts, err = decodeTimestamp(val, zoneNone)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2006, 12, 15, 17, 30, 55, 500, time.UTC), ts)
+
+	_, err = decodeTimestamp(val[:4], zoneNone)
+	assert.Error(t, err)
+}
+
+func TestDecodeIngresDateLayout(t *testing.T) {
+	val := make([]byte, ingresDateLen)
+	val[0] = dnAbsolute
+	nativeEndian.PutUint16(val[2:], 2021)
+	nativeEndian.PutUint16(val[4:], 10)
+	nativeEndian.PutUint16(val[6:], 10)
+
+	d, ok, err := decodeIngresDate(val)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2021, 10, 10, 0, 0, 0, 0, time.UTC), d)
+
+	val[0] = dnAbsolute | dnTimespec
+	nativeEndian.PutUint32(val[8:], 3_600_000)
+	d, ok, err = decodeIngresDate(val)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.True(t, d.Equal(time.Date(2021, 10, 10, 1, 0, 0, 0, time.UTC)))
+
+	val[0] = dnLength
+	_, ok, err = decodeIngresDate(val)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestIntervalLayout(t *testing.T) {
+	d := -(18*24*time.Hour + 12*time.Hour + 2*time.Minute + 23*time.Second + 123450*time.Microsecond)
+	res, err := decodeIntervalDS(encodeIntervalDS(d))
+	require.NoError(t, err)
+	assert.Equal(t, d, res)
+
+	ym, err := decodeIntervalYM(encodeIntervalYM(YearMonthInterval{Years: 1, Months: 14}))
+	require.NoError(t, err)
+	assert.Equal(t, YearMonthInterval{Years: 2, Months: 2}, ym)
+	assert.Equal(t, "-1-02", NewYearMonthInterval(-14).String())
+}
+
+func TestScanYearMonthInterval(t *testing.T) {
+	// the driver value is the string form, database/sql stores it into
+	// strings as it is
+	val := YearMonthInterval{Years: -1, Months: -2}.String()
+
+	var ns sql.NullString
+	require.NoError(t, ns.Scan(val))
+	assert.Equal(t, "-1-02", ns.String)
+
+	var ym YearMonthInterval
+	require.NoError(t, ym.Scan(val))
+	assert.Equal(t, -14, ym.TotalMonths())
+	require.NoError(t, ym.Scan([]byte("55-04")))
+	assert.Equal(t, YearMonthInterval{Years: 55, Months: 4}, ym)
+
+	for _, s := range []string{"", "55", "55-12", "--1-02", "1-x"} {
+		_, err := ParseYearMonthInterval(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestEncodeTimestamp(t *testing.T) {
+	ts := time.Date(2006, 12, 15, 9, 30, 55, 123, time.FixedZone("", -8*3600-30*60))
+
+	res, err := decodeTimestamp(encodeTimestamp(ts), zoneFixed)
+	require.NoError(t, err)
+	assert.True(t, ts.Equal(res))
+	_, offset := res.Zone()
+	assert.Equal(t, -8*3600-30*60, offset)
+}
@@ -0,0 +1,259 @@
+package ingres
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maximum precision of Ingres decimal type
+const maxDecimalPrecision = 39
+
+// money is kept by the server as float8 number of cents
+const (
+	moneyPrecision = 14
+	moneyScale     = 2
+)
+
+var (
+	errDecimalSyntax    = errors.New("invalid decimal syntax")
+	errDecimalPrecision = errors.New("decimal precision is out of range")
+	errDecimalInexact   = errors.New("value can't be represented with the requested scale")
+)
+
+// Decimal is an exact decimal number. DECIMAL and MONEY columns are returned
+// by the driver as strings with all digits of the scale, so they could be
+// scanned into strings too; Decimal.Scan keeps the scale of the column, its
+// precision is reported by ColumnTypePrecisionScale.
+type Decimal struct {
+	unscaled  *big.Int // value * 10^scale
+	precision int
+	scale     int
+}
+
+// NewDecimal returns unscaled * 10^-scale. If precision is 0 it is derived
+// from the number of digits.
+func NewDecimal(unscaled *big.Int, precision, scale int) (Decimal, error) {
+	if scale < 0 {
+		return Decimal{}, errDecimalPrecision
+	}
+
+	d := Decimal{
+		unscaled:  new(big.Int).Set(unscaled),
+		precision: precision,
+		scale:     scale,
+	}
+
+	digits := d.digits()
+	if d.precision == 0 {
+		d.precision = digits
+		if scale > digits {
+			d.precision = scale
+		}
+	}
+	if digits > d.precision || scale > d.precision {
+		return Decimal{}, errDecimalPrecision
+	}
+	return d, nil
+}
+
+// NewDecimalFromRat converts r to a decimal with the given scale. It fails
+// if r can't be represented exactly.
+func NewDecimalFromRat(r *big.Rat, scale int) (Decimal, error) {
+	if scale < 0 {
+		return Decimal{}, errDecimalPrecision
+	}
+
+	num := new(big.Int).Mul(r.Num(), pow10(scale))
+	unscaled, rem := new(big.Int).QuoRem(num, r.Denom(), new(big.Int))
+	if rem.Sign() != 0 {
+		return Decimal{}, errDecimalInexact
+	}
+	return NewDecimal(unscaled, 0, scale)
+}
+
+// ParseDecimal parses numbers like "-123.4500", the scale is taken from
+// the number of fractional digits.
+func ParseDecimal(s string) (Decimal, error) {
+	s = strings.TrimSpace(s)
+
+	digits := strings.TrimLeft(s, "+-")
+	if len(s)-len(digits) > 1 {
+		return Decimal{}, errDecimalSyntax
+	}
+
+	intPart, fracPart, _ := strings.Cut(digits, ".")
+	if len(intPart)+len(fracPart) == 0 {
+		return Decimal{}, errDecimalSyntax
+	}
+	for _, c := range intPart + fracPart {
+		if c < '0' || c > '9' {
+			return Decimal{}, errDecimalSyntax
+		}
+	}
+
+	unscaled, _ := new(big.Int).SetString("0"+intPart+fracPart, 10)
+	if strings.HasPrefix(s, "-") {
+		unscaled.Neg(unscaled)
+	}
+	return NewDecimal(unscaled, 0, len(fracPart))
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+func (d Decimal) bigInt() *big.Int {
+	if d.unscaled == nil {
+		return new(big.Int)
+	}
+	return d.unscaled
+}
+
+func (d Decimal) digits() int {
+	abs := new(big.Int).Abs(d.bigInt())
+	if abs.Sign() == 0 {
+		return 1
+	}
+	return len(abs.String())
+}
+
+// Precision returns the total number of digits.
+func (d Decimal) Precision() int {
+	if d.precision == 0 {
+		return d.digits()
+	}
+	return d.precision
+}
+
+// Scale returns the number of fractional digits.
+func (d Decimal) Scale() int {
+	return d.scale
+}
+
+// Unscaled returns the value multiplied by 10^Scale().
+func (d Decimal) Unscaled() *big.Int {
+	return new(big.Int).Set(d.bigInt())
+}
+
+// Rat returns the exact value of d.
+func (d Decimal) Rat() *big.Rat {
+	return new(big.Rat).SetFrac(d.bigInt(), pow10(d.scale))
+}
+
+func (d Decimal) String() string {
+	abs := new(big.Int).Abs(d.bigInt()).String()
+	if len(abs) <= d.scale {
+		abs = strings.Repeat("0", d.scale-len(abs)+1) + abs
+	}
+
+	var sb strings.Builder
+	if d.bigInt().Sign() < 0 {
+		sb.WriteByte('-')
+	}
+	sb.WriteString(abs[:len(abs)-d.scale])
+	if d.scale > 0 {
+		sb.WriteByte('.')
+		sb.WriteString(abs[len(abs)-d.scale:])
+	}
+	return sb.String()
+}
+
+// Scan implements sql.Scanner.
+func (d *Decimal) Scan(src any) error {
+	var err error
+
+	switch v := src.(type) {
+	case Decimal:
+		*d = v
+	case string:
+		*d, err = ParseDecimal(v)
+	case []byte:
+		*d, err = ParseDecimal(string(v))
+	case int64:
+		*d, err = NewDecimal(big.NewInt(v), 0, 0)
+	case float64:
+		*d, err = ParseDecimal(strconv.FormatFloat(v, 'f', -1, 64))
+	case nil:
+		return errors.New("can't scan NULL into Decimal")
+	default:
+		return fmt.Errorf("can't scan %T into Decimal", src)
+	}
+	return err
+}
+
+// Value implements driver.Valuer.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// decodePacked decodes Ingres packed decimal: two digits per byte, the last
+// half-byte is the sign.
+func decodePacked(val []byte, precision, scale int) (Decimal, error) {
+	if len(val) == 0 {
+		return Decimal{}, errDecimalSyntax
+	}
+
+	digits := make([]byte, 0, len(val)*2)
+	for i, b := range val {
+		digits = append(digits, '0'+b>>4)
+		if i < len(val)-1 {
+			digits = append(digits, '0'+b&0x0f)
+		}
+	}
+
+	unscaled, ok := new(big.Int).SetString(string(digits), 10)
+	if !ok {
+		return Decimal{}, errDecimalSyntax
+	}
+
+	switch val[len(val)-1] & 0x0f {
+	case 0x0b, 0x0d:
+		unscaled.Neg(unscaled)
+	}
+	return NewDecimal(unscaled, precision, scale)
+}
+
+// encodePacked returns d in packed form together with the precision and
+// scale for the descriptor.
+func encodePacked(d Decimal) ([]byte, int, int, error) {
+	precision := d.Precision()
+	if precision > maxDecimalPrecision {
+		return nil, 0, 0, errDecimalPrecision
+	}
+
+	res := make([]byte, precision/2+1)
+	digits := new(big.Int).Abs(d.bigInt()).String()
+
+	sign := byte(0x0c)
+	if d.bigInt().Sign() < 0 {
+		sign = 0x0d
+	}
+	res[len(res)-1] = sign
+
+	// fill half-bytes from the right, just before the sign
+	pos := len(res)*2 - 2
+	for i := len(digits) - 1; i >= 0; i-- {
+		digit := digits[i] - '0'
+		if pos%2 == 0 {
+			res[pos/2] |= digit << 4
+		} else {
+			res[pos/2] |= digit
+		}
+		pos--
+	}
+	return res, precision, d.scale, nil
+}
+
+func decodeMoney(val []byte) (Decimal, error) {
+	if len(val) < 8 {
+		return Decimal{}, errDecimalSyntax
+	}
+
+	cents := math.Round(math.Float64frombits(nativeEndian.Uint64(val)))
+	return NewDecimal(big.NewInt(int64(cents)), moneyPrecision, moneyScale)
+}
@@ -0,0 +1,84 @@
+package ingres
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"math"
+	"math/big"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPackedDecimal(t *testing.T) {
+	for _, s := range []string{"0", "1.5", "-123.4500", "0.001", "12345678901234567890.12345678901234567"} {
+		d, err := ParseDecimal(s)
+		require.NoError(t, err)
+		assert.Equal(t, s, d.String())
+
+		packed, precision, scale, err := encodePacked(d)
+		require.NoError(t, err)
+		assert.Equal(t, precision/2+1, len(packed))
+
+		res, err := decodePacked(packed, precision, scale)
+		require.NoError(t, err)
+		assert.Equal(t, s, res.String())
+		assert.Equal(t, d.Scale(), res.Scale())
+	}
+
+	// decimal(5,2) -12.30
+	d, err := decodePacked([]byte{0x01, 0x23, 0x0d}, 5, 2)
+	require.NoError(t, err)
+	assert.Equal(t, "-12.30", d.String())
+	assert.Equal(t, 5, d.Precision())
+}
+
+func TestScanDecimal(t *testing.T) {
+	// decimal(5,2) -12.30 and money 12.34 as the driver returns them
+	d, err := decodePacked([]byte{0x01, 0x23, 0x0d}, 5, 2)
+	require.NoError(t, err)
+	cents := make([]byte, 8)
+	nativeEndian.PutUint64(cents, math.Float64bits(1234))
+	m, err := decodeMoney(cents)
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		val      driver.Value
+		expected string
+		scale    int
+	}{
+		{d.String(), "-12.30", 2},
+		{m.String(), "12.34", 2},
+	} {
+		// database/sql stores the value into strings and numbers
+		var ns sql.NullString
+		require.NoError(t, ns.Scan(tc.val))
+		assert.Equal(t, tc.expected, ns.String)
+
+		var nf sql.NullFloat64
+		require.NoError(t, nf.Scan(tc.val))
+
+		var res Decimal
+		require.NoError(t, res.Scan(tc.val))
+		assert.Equal(t, tc.expected, res.String())
+		assert.Equal(t, tc.scale, res.Scale())
+	}
+}
+
+func TestDecimalRat(t *testing.T) {
+	d, err := NewDecimalFromRat(big.NewRat(1, 8), 4)
+	require.NoError(t, err)
+	assert.Equal(t, "0.1250", d.String())
+	assert.Equal(t, 0, d.Rat().Cmp(big.NewRat(1, 8)))
+
+	_, err = NewDecimalFromRat(big.NewRat(1, 3), 10)
+	assert.Error(t, err)
+
+	var s Decimal
+	require.NoError(t, s.Scan("7.10"))
+	assert.Equal(t, 2, s.Scale())
+	v, err := s.Value()
+	require.NoError(t, err)
+	assert.Equal(t, "7.10", v)
+}
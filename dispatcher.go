@@ -0,0 +1,185 @@
+package ingres
+
+/*
+#include <iiapi.h>
+*/
+import "C"
+import (
+	"errors"
+	"runtime"
+	"sync"
+)
+
+const (
+	// dispatchTimeout limits IIapi_wait of the dispatcher, in milliseconds
+	dispatchTimeout = 1000
+
+	// maxWaitFailures is the number of IIapi_wait failures in a row after
+	// which the API is considered unable to complete the requests
+	maxWaitFailures = 3
+)
+
+var errNoCallback = errors.New("the request is made without setCallback")
+
+// request is an API call made with setCallback
+type request struct {
+	done      chan struct{}
+	genParm   *C.IIAPI_GENPARM // set when the request is issued
+	completed bool
+	issued    bool
+	failed    bool // IIapi_wait failed before completion
+	status    C.IIAPI_STATUS
+}
+
+// dispatcher runs IIapi_wait on its own thread while there are issued
+// requests, callbacks of completed requests close their channels
+var dispatcher = struct {
+	sync.Mutex
+	started  bool
+	nextID   uintptr
+	requests map[uintptr]*request
+	issued   int
+	wake     chan struct{}
+}{
+	requests: make(map[uintptr]*request),
+	wake:     make(chan struct{}, 1),
+}
+
+// newRequest registers a request and returns its id, ids are never zero
+func newRequest() uintptr {
+	dispatcher.Lock()
+	defer dispatcher.Unlock()
+
+	dispatcher.nextID++
+	if dispatcher.nextID == 0 {
+		dispatcher.nextID++
+	}
+
+	id := dispatcher.nextID
+	dispatcher.requests[id] = &request{done: make(chan struct{})}
+	return id
+}
+
+// issueRequest is called after the request is made, the dispatcher waits
+// for it from now on
+func issueRequest(id uintptr, genParm *C.IIAPI_GENPARM) (*request, error) {
+	dispatcher.Lock()
+	defer dispatcher.Unlock()
+
+	r, ok := dispatcher.requests[id]
+	if !ok || r.issued {
+		return nil, errNoCallback
+	}
+
+	r.genParm = genParm
+	r.issued = true
+	dispatcher.issued++
+
+	if !dispatcher.started {
+		dispatcher.started = true
+		go dispatch()
+	}
+
+	select {
+	case dispatcher.wake <- struct{}{}:
+	default:
+	}
+	return r, nil
+}
+
+func finishRequest(id uintptr) {
+	dispatcher.Lock()
+	defer dispatcher.Unlock()
+
+	if r, ok := dispatcher.requests[id]; ok {
+		delete(dispatcher.requests, id)
+		if r.issued {
+			dispatcher.issued--
+		}
+	}
+}
+
+// complete marks the request completed, it's called with the lock held
+func (r *request) complete() {
+	if !r.completed {
+		r.completed = true
+		close(r.done)
+	}
+}
+
+// requestCompleted is the callback of all requests, the closure is the id
+// of the request. It's called by IIapi_wait of the dispatcher or by the
+// call itself if the request is completed at once.
+//
+//export requestCompleted
+func requestCompleted(closure C.II_PTR, parmBlock C.II_PTR) {
+	completeRequest(uintptr(closure))
+}
+
+func completeRequest(id uintptr) {
+	dispatcher.Lock()
+	defer dispatcher.Unlock()
+
+	if r, ok := dispatcher.requests[id]; ok {
+		r.complete()
+	}
+}
+
+func hasIssuedRequests() bool {
+	dispatcher.Lock()
+	defer dispatcher.Unlock()
+	return dispatcher.issued > 0
+}
+
+// waitFailed is called when IIapi_wait fails. Requests which the API has
+// completed without the callback get their own status. Other requests are
+// still waited for, unless the failure is of the whole environment: the API
+// is not initialized anymore, or IIapi_wait fails maxWaitFailures times in
+// a row. Then they are completed with the status of IIapi_wait.
+func waitFailed(status C.IIAPI_STATUS, envFailure bool) {
+	dispatcher.Lock()
+	defer dispatcher.Unlock()
+
+	for _, r := range dispatcher.requests {
+		if !r.issued || r.completed {
+			continue
+		}
+
+		if r.genParm.gp_completed != 0 {
+			r.complete()
+		} else if envFailure {
+			r.failed = true
+			r.status = status
+			r.complete()
+		}
+	}
+}
+
+// dispatch is the only caller of IIapi_wait
+func dispatch() {
+	runtime.LockOSThread()
+
+	var waitParm C.IIAPI_WAITPARM
+	failures := 0
+	for {
+		if !hasIssuedRequests() {
+			<-dispatcher.wake
+			continue
+		}
+
+		waitParm.wt_timeout = dispatchTimeout
+		C.IIapi_wait(&waitParm)
+
+		if waitParm.wt_status == C.IIAPI_ST_SUCCESS || waitParm.wt_status == C.IIAPI_ST_WARNING {
+			failures = 0
+			continue
+		}
+
+		failures++
+		envFailure := waitParm.wt_status == C.IIAPI_ST_NOT_INITIALIZED || failures >= maxWaitFailures
+		waitFailed(waitParm.wt_status, envFailure)
+		if envFailure {
+			failures = 0
+		}
+	}
+}
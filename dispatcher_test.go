@@ -0,0 +1,54 @@
+package ingres
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func pendingRequests() int {
+	dispatcher.Lock()
+	defer dispatcher.Unlock()
+	return len(dispatcher.requests)
+}
+
+func TestRequestRegistry(t *testing.T) {
+	id := newRequest()
+	assert.NotZero(t, id)
+
+	dispatcher.Lock()
+	r := dispatcher.requests[id]
+	dispatcher.Unlock()
+	require.NotNil(t, r)
+
+	completeRequest(id)
+	completeRequest(id) // the callback could be called once only, but it's safe
+	<-r.done
+
+	finishRequest(id)
+	_, err := issueRequest(id, nil)
+	assert.ErrorIs(t, err, errNoCallback)
+	assert.Equal(t, 0, pendingRequests())
+}
+
+func TestWaitCompletedRequests(t *testing.T) {
+	// the stub completes requests at once with a failure, the errors should
+	// come from checkError
+	_, err := autoCommitContext(context.Background(), nil, nil)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errNoCallback)
+
+	s := makeStmt(&OpenAPIConn{}, "select ?", QUERY)
+	s.args = []driver.Value{int64(1)}
+	err = s.sendArgs(context.Background(), nil, nil)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errNoCallback)
+
+	err = commitTransaction(nil)
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, errNoCallback)
+	assert.Equal(t, 0, pendingRequests())
+}
@@ -0,0 +1,111 @@
+package ingres
+
+import (
+	"context"
+	"math"
+)
+
+// defaultFetchRows is the number of rows fetched at once if it's not set by
+// fetchrows parameter or WithFetchRows
+const defaultFetchRows = 1
+
+// maxFetchBufferSize limits the size of the row buffers of one batch
+const maxFetchBufferSize = 1 << 20
+
+type fetchRowsKey struct{}
+
+// WithFetchRows returns a context which sets the number of rows fetched by
+// one call to the server for queries made with it. Rows with long columns
+// are always fetched one by one.
+func WithFetchRows(ctx context.Context, n int) context.Context {
+	return context.WithValue(ctx, fetchRowsKey{}, n)
+}
+
+func (c *OpenAPIConn) fetchRows(ctx context.Context) int {
+	if n, ok := ctx.Value(fetchRowsKey{}).(int); ok && n > 0 {
+		return n
+	}
+
+	if c.params.FetchRows > 0 {
+		return c.params.FetchRows
+	}
+	return defaultFetchRows
+}
+
+// batchRowCount returns the number of rows fetched at once, the number of
+// values in the batch is limited by the API and the size of its buffers by
+// maxFetchBufferSize
+func batchRowCount(fetchRows int, columns uint16, rowSize int) uint16 {
+	if fetchRows <= 1 || columns == 0 {
+		return 1
+	}
+
+	maxRows := math.MaxInt16 / int(columns)
+	if rowSize > 0 && maxFetchBufferSize/rowSize < maxRows {
+		maxRows = maxFetchBufferSize / rowSize
+	}
+	if fetchRows > maxRows {
+		fetchRows = maxRows
+	}
+	if fetchRows < 1 {
+		return 1
+	}
+	return uint16(fetchRows)
+}
+
+// rowBatch keeps rows fetched by one call, the values of i-th column of
+// r-th row are at r*columns+i
+type rowBatch struct {
+	block *colBlock
+	vals  [][]byte
+	nulls []bool
+	pos   int  // the current row
+	last  bool // no more rows on the server
+}
+
+func newRowBatch(block *colBlock) *rowBatch {
+	n := int(block.count) * int(block.rowCount)
+	return &rowBatch{
+		block: block,
+		vals:  make([][]byte, n),
+		nulls: make([]bool, n),
+		pos:   -1,
+	}
+}
+
+// nextBatchRow makes the next row of the batch the current one, the next
+// batch is fetched when the rows are over
+func (rs *rows) nextBatchRow(ctx context.Context) error {
+	b := rs.batch
+	b.pos++
+
+	if b.pos >= int(b.block.rowsReturned) {
+		if b.last {
+			rs.done = true
+			return rs.fetchInfoContext(ctx)
+		}
+
+		for i := range b.nulls {
+			b.nulls[i] = false
+		}
+
+		_, noData, err := rs.getColumns(ctx, b.block)
+		if err != nil {
+			return err
+		}
+
+		b.pos = 0
+		b.last = noData
+		if b.block.rowsReturned == 0 {
+			rs.done = true
+			return rs.fetchInfoContext(ctx)
+		}
+	}
+
+	count := int(b.block.count)
+	for i := 0; i < count; i++ {
+		rs.vals[i] = b.vals[b.pos*count+i]
+		rs.nulls[i] = b.nulls[b.pos*count+i]
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package ingres
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchRowCount(t *testing.T) {
+	assert.Equal(t, uint16(1), batchRowCount(0, 5, 40))
+	assert.Equal(t, uint16(1), batchRowCount(1, 5, 40))
+	assert.Equal(t, uint16(100), batchRowCount(100, 5, 40))
+	assert.Equal(t, uint16(32767/1000), batchRowCount(100, 1000, 4000))
+	assert.Equal(t, uint16(1), batchRowCount(100, 32767, 32767))
+
+	// 10 varchar(32000) columns
+	assert.Equal(t, uint16(maxFetchBufferSize/320020), batchRowCount(100, 10, 320020))
+	assert.Equal(t, uint16(1), batchRowCount(100, 1, maxFetchBufferSize*2))
+}
+
+func TestFetchRowsContext(t *testing.T) {
+	c := &OpenAPIConn{}
+	ctx := context.Background()
+	assert.Equal(t, defaultFetchRows, c.fetchRows(ctx))
+
+	c.params.FetchRows = 10
+	assert.Equal(t, 10, c.fetchRows(ctx))
+	assert.Equal(t, 3, c.fetchRows(WithFetchRows(ctx, 3)))
+	assert.Equal(t, 10, c.fetchRows(WithFetchRows(ctx, 0)))
+}
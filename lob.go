@@ -0,0 +1,171 @@
+package ingres
+
+/*
+#include <iiapi.h>
+*/
+import "C"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+var errLOBClosed = errors.New("LOB reader is used after its row has been left")
+
+// LOBReader streams the value of a long column. It's returned for the last
+// column of a query when StreamLOBs (lobstream=true in DSN) is enabled, and
+// can be scanned into *LOBReader or io.Reader. The reader is valid until
+// the next call of Next or Close of the rows it came from.
+//
+// Long nvarchar values are returned as UTF-8.
+type LOBReader struct {
+	lob *lobStream
+}
+
+// Read implements io.Reader.
+func (r *LOBReader) Read(p []byte) (int, error) {
+	if r.lob == nil {
+		return 0, io.EOF
+	}
+	if r.lob.closed {
+		return 0, errLOBClosed
+	}
+
+	c := r.lob.rs.stmt.conn
+	if err := c.acquireRows("read", r.lob.rs); err != nil {
+		return 0, err
+	}
+	defer c.release()
+
+	return r.lob.read(p)
+}
+
+// Scan implements sql.Scanner.
+func (r *LOBReader) Scan(src any) error {
+	switch v := src.(type) {
+	case *LOBReader:
+		*r = *v
+	case nil:
+		r.lob = nil
+	default:
+		return fmt.Errorf("can't scan %T into LOBReader", src)
+	}
+	return nil
+}
+
+// LOBStream is a parameter which content is read from Reader and sent to
+// the server segment by segment, without loading it into memory. It's sent
+// as long byte, or as long varchar if Text is set. Plain io.Reader
+// parameters are sent the same way as long byte.
+type LOBStream struct {
+	Reader io.Reader
+	Text   bool
+}
+
+// lobStream keeps the state of a streamed column for one row
+type lobStream struct {
+	rs    *rows
+	block *colBlock
+
+	data   []byte // unread part of the current segment
+	carry  []uint16
+	more   bool // server has more segments
+	closed bool
+}
+
+// newLOBStream is called when the first segment is already in rows.vals
+func newLOBStream(rs *rows, block *colBlock, more bool) *lobStream {
+	lob := &lobStream{rs: rs, block: block, more: more}
+	lob.setSegment()
+	return lob
+}
+
+func (l *lobStream) setSegment() {
+	var segment []byte
+
+	// the first two bytes contain the segment length
+	sz := l.block.cols.dv_length
+	if sz > 2 {
+		segment = l.rs.vals[l.block.colIndex][2:sz]
+	}
+
+	if l.rs.colTyps[l.block.colIndex].ingDataType != C.IIAPI_LNVCH_TYPE {
+		l.data = segment
+		return
+	}
+
+	units := make([]uint16, 0, len(l.carry)+len(segment)/2)
+	units = append(units, l.carry...)
+	for i := 0; i+1 < len(segment); i += 2 {
+		units = append(units, nativeEndian.Uint16(segment[i:]))
+	}
+
+	// surrogate pair could be split between segments
+	l.carry = nil
+	if n := len(units); l.more && n > 0 && units[n-1] >= 0xd800 && units[n-1] < 0xdc00 {
+		l.carry = units[n-1:]
+		units = units[:n-1]
+	}
+	l.data = []byte(string(utf16.Decode(units)))
+}
+
+func (l *lobStream) next(ctx context.Context) error {
+	more, _, err := l.rs.getColumns(ctx, l.block)
+	if err != nil {
+		l.closed = true
+		return err
+	}
+
+	l.more = more
+	l.setSegment()
+	return nil
+}
+
+func (l *lobStream) read(p []byte) (int, error) {
+	if l.closed {
+		return 0, errLOBClosed
+	}
+
+	for len(l.data) == 0 {
+		if !l.more {
+			return 0, io.EOF
+		}
+
+		if err := l.next(context.Background()); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, l.data)
+	l.data = l.data[n:]
+	return n, nil
+}
+
+// discard skips unread segments so the next row can be fetched
+func (l *lobStream) discard(ctx context.Context) error {
+	for !l.closed && l.more {
+		if err := l.next(ctx); err != nil {
+			return err
+		}
+	}
+
+	l.closed = true
+	l.data = nil
+	return nil
+}
+
+func (rs *rows) discardLOB(ctx context.Context) error {
+	for _, block := range rs.colBlocks {
+		if block.lob != nil {
+			lob := block.lob
+			block.lob = nil
+
+			if err := lob.discard(ctx); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package ingres
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadSegment(t *testing.T) {
+	r := strings.NewReader(strings.Repeat("x", lobSegmentLen+10))
+	segment := make([]byte, lobSegmentLen+2)
+
+	n, err := readSegment(r, segment, 1)
+	require.NoError(t, err)
+	assert.Equal(t, lobSegmentLen, n)
+	assert.Equal(t, uint16(lobSegmentLen), nativeEndian.Uint16(segment))
+
+	n, err = readSegment(r, segment, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, uint16(10), nativeEndian.Uint16(segment))
+
+	n, err = readSegment(r, segment, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, n)
+}
+
+func TestReadSegmentUTF16(t *testing.T) {
+	r := strings.NewReader(string(encodeUTF16("héllo")))
+	segment := make([]byte, lobSegmentLen+2)
+
+	n, err := readSegment(r, segment, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, uint16(5), nativeEndian.Uint16(segment))
+}
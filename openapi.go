@@ -88,6 +88,14 @@ static IIAPI_STATUS convert_to_string(IIAPI_DT_ID dt, II_PTR val, uint16_t len,
 }
 
 extern void HandleTraceMessage(IIAPI_TRACEPARM *parm);
+extern void requestCompleted(II_PTR closure, II_PTR parmBlock);
+
+// the closure is the id of the request, not a pointer
+static inline void set_callback(IIAPI_GENPARM *genParm, uintptr_t id)
+{
+    genParm->gp_callback = requestCompleted;
+    genParm->gp_closure = (II_PTR) id;
+}
 
 static IIAPI_STATUS enable_trace(II_PTR env_handle)
 {
@@ -114,6 +122,7 @@ import (
 	"io"
 	"log"
 	"math"
+	"net/netip"
 	"reflect"
 	"strconv"
 	"strings"
@@ -132,7 +141,21 @@ type OpenAPIEnv struct {
 type OpenAPIConn struct {
 	env                *OpenAPIEnv
 	handle             C.II_PTR
+	params             ConnParams
 	currentTransaction *OpenAPITransaction
+
+	stmtSeq   int      // for names of prepared statements
+	stmtNames []string // names of closed prepared statements
+
+	repeatQueries map[string]*repeatQuery
+	procParams    map[string][]string // parameter names of procedures
+
+	cursors map[string]C.II_PTR // statement handles of open named cursors
+
+	mu    sync.Mutex // serializes use of the connection
+	state ConnState
+	query *rows // rows which hold the connection in ConnInQuery
+	txSeq int   // incremented when a transaction ends
 }
 
 type OpenAPITransaction struct {
@@ -146,6 +169,24 @@ type ConnParams struct {
 	UserName string
 	Password string
 	Timeout  int
+
+	// return trailing long column of a query as *LOBReader
+	StreamLOBs bool
+
+	// bind string parameters as nvarchar
+	NVarchar bool
+
+	// translate $N parameter markers into positional ones
+	DollarPlaceholders bool
+
+	// run statements with arguments as repeat queries
+	RepeatQueries bool
+
+	// rows fetched by one call, one if not set
+	FetchRows int
+
+	// split queries separated by semicolons into several result sets
+	MultiStatements bool
 }
 
 type columnDesc struct {
@@ -168,11 +209,16 @@ type rowsHeader struct {
 type colBlock struct {
 	colIndex  uint16
 	segmented bool
+	streamed  bool // segments are read on demand through LOBReader
 	count     uint16
+	rowCount  uint16             // rows fetched by one IIapi_getColumns call
 	cols      *C.IIAPI_DATAVALUE // dv_value will point to vals[x] in rows.vals
 	nulls     []*bool            // items will point to nulls[x] in rows.nulls
 
+	rowsReturned uint16 // by the last IIapi_getColumns call
+
 	buffer *bytes.Buffer
+	lob    *lobStream // streamed value of the current row
 }
 
 type colGetBlocks []*colBlock
@@ -199,9 +245,22 @@ type rows struct {
 	   and then blocks 6-10
 	*/
 	colBlocks colGetBlocks
+	batch     *rowBatch // rows fetched at once, if there are no long columns
 
 	lastInsertId int64
 	rowsAffected int64
+	infoFetched  bool
+	repeatHandle C.II_PTR // of just defined repeat query
+
+	outVals       []driver.Value // values of BYREF procedure parameters
+	procReturn    int64
+	hasProcReturn bool
+	procOut       *procOutputs // assigned after the last row
+
+	pending []pendingQuery // the rest of a combined query
+
+	cursorName string // of named cursor, for positioned updates
+	txSeq      int    // of the connection when the query was started
 }
 
 type QueryType uint
@@ -212,6 +271,8 @@ const (
 	EXEC           QueryType = C.IIAPI_QT_EXEC
 	OPEN           QueryType = C.IIAPI_QT_OPEN
 	EXEC_PROCEDURE QueryType = C.IIAPI_QT_EXEC_PROCEDURE
+	CURSOR_UPDATE  QueryType = C.IIAPI_QT_CURSOR_UPDATE
+	CURSOR_DELETE  QueryType = C.IIAPI_QT_CURSOR_DELETE
 )
 
 type stmt struct {
@@ -220,6 +281,15 @@ type stmt struct {
 	queryType   QueryType
 	transaction *OpenAPITransaction
 
+	prepared *preparedStmt
+	numInput int
+
+	proc       *procCall
+	procParams []procParam
+
+	cursorHandle C.II_PTR  // for positioned updates and deletes
+	cursorOp     QueryType // CURSOR_UPDATE or CURSOR_DELETE
+
 	args []driver.Value
 }
 
@@ -286,8 +356,7 @@ func (env *OpenAPIEnv) Connect(params ConnParams) (*OpenAPIConn, error) {
 func (env *OpenAPIEnv) ConnectContext(ctx context.Context, params ConnParams) (*OpenAPIConn, error) {
 	var connParm C.IIAPI_CONNPARM
 
-	connParm.co_genParm.gp_callback = nil
-	connParm.co_genParm.gp_closure = nil
+	setCallback(&connParm.co_genParm)
 	connParm.co_type = C.IIAPI_CT_SQL
 	connParm.co_target = C.CString(params.DbName)
 	connParm.co_connHandle = env.handle
@@ -319,23 +388,21 @@ func (env *OpenAPIEnv) ConnectContext(ctx context.Context, params ConnParams) (*
 		}
 
 		var abortParm C.IIAPI_ABORTPARM
-		abortParm.ab_genParm.gp_callback = nil
-		abortParm.ab_genParm.gp_closure = nil
+		setCallback(&abortParm.ab_genParm)
 		abortParm.ab_connHandle = connParm.co_connHandle
 
 		C.IIapi_abort(&abortParm)
-		wait(&abortParm.ab_genParm)
+		_ = wait(&abortParm.ab_genParm)
 	})
 	if err != nil {
 		if connParm.co_connHandle != nil && connParm.co_connHandle != env.handle {
 			var abortParm C.IIAPI_ABORTPARM
 
-			abortParm.ab_genParm.gp_callback = nil
-			abortParm.ab_genParm.gp_closure = nil
+			setCallback(&abortParm.ab_genParm)
 			abortParm.ab_connHandle = connParm.co_connHandle
 
 			C.IIapi_abort(&abortParm)
-			wait(&abortParm.ab_genParm)
+			_ = wait(&abortParm.ab_genParm)
 		}
 		return nil, err
 	}
@@ -345,21 +412,21 @@ func (env *OpenAPIEnv) ConnectContext(ctx context.Context, params ConnParams) (*
 		return &OpenAPIConn{
 			env:    env,
 			handle: connParm.co_connHandle,
+			params: params,
 		}, nil
 	}
 
 	if connParm.co_connHandle != nil {
 		var abortParm C.IIAPI_ABORTPARM
 
-		abortParm.ab_genParm.gp_callback = nil
-		abortParm.ab_genParm.gp_closure = nil
+		setCallback(&abortParm.ab_genParm)
 		abortParm.ab_connHandle = connParm.co_connHandle
 
 		/*
 		 ** Make sync request.
 		 */
 		C.IIapi_abort(&abortParm)
-		wait(&abortParm.ab_genParm)
+		_ = wait(&abortParm.ab_genParm)
 
 		abortErr := checkError("IIapi_abort()", &abortParm.ab_genParm)
 		if verbose && abortErr != nil {
@@ -377,12 +444,13 @@ func (env *OpenAPIEnv) ConnectContext(ctx context.Context, params ConnParams) (*
 func disconnect(c *OpenAPIConn) error {
 	var disconnParm C.IIAPI_DISCONNPARM
 
-	disconnParm.dc_genParm.gp_callback = nil
-	disconnParm.dc_genParm.gp_closure = nil
+	setCallback(&disconnParm.dc_genParm)
 	disconnParm.dc_connHandle = c.handle
 
 	C.IIapi_disconnect(&disconnParm)
-	wait(&disconnParm.dc_genParm)
+	if err := wait(&disconnParm.dc_genParm); err != nil {
+		return err
+	}
 
 	// Check results.
 	err := checkError("IIapi_disconnect()", &disconnParm.dc_genParm)
@@ -396,8 +464,7 @@ func autoCommit(connHandle C.II_PTR, transHandle C.II_PTR) (C.II_PTR, error) {
 func autoCommitContext(ctx context.Context, connHandle C.II_PTR, transHandle C.II_PTR) (C.II_PTR, error) {
 	var autoParm C.IIAPI_AUTOPARM
 
-	autoParm.ac_genParm.gp_callback = nil
-	autoParm.ac_genParm.gp_closure = nil
+	setCallback(&autoParm.ac_genParm)
 	autoParm.ac_connHandle = connHandle
 	autoParm.ac_tranHandle = transHandle
 
@@ -423,6 +490,19 @@ func (c *OpenAPIConn) AutoCommit() error {
 }
 
 func (c *OpenAPIConn) AutoCommitContext(ctx context.Context) error {
+	if err := c.acquire("autocommit"); err != nil {
+		return err
+	}
+	defer c.release()
+
+	return c.enableAutoCommit(ctx)
+}
+
+// enableAutoCommit is AutoCommitContext of acquired connection
+func (c *OpenAPIConn) enableAutoCommit(ctx context.Context) error {
+	if c.state == ConnInTx {
+		return c.stateError("autocommit", ErrTxInProgress)
+	}
 	if c.currentTransaction != nil {
 		return errors.New("can't enable autocommit with active transactions")
 	}
@@ -441,19 +521,29 @@ func (c *OpenAPIConn) AutoCommitContext(ctx context.Context) error {
 }
 
 func (c *OpenAPIConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	query, err := beginStatement(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.acquire("begin"); err != nil {
+		return nil, err
+	}
+	defer c.release()
+
 	if c.currentTransaction != nil {
 		if c.currentTransaction.autocommit {
-			err := c.DisableAutoCommit()
+			err := c.disableAutoCommit()
 
 			if err != nil {
 				return nil, err
 			}
 		} else {
-			return nil, fmt.Errorf("%s", "already in transaction")
+			return nil, c.stateError("begin", ErrTxInProgress)
 		}
 	}
 
-	s := makeStmt(c, "begin transaction", EXEC)
+	s := makeStmt(c, query, EXEC)
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
@@ -461,7 +551,7 @@ func (c *OpenAPIConn) BeginTx(ctx context.Context, opts driver.TxOptions) (drive
 	rows, err := s.runQuery(ctx, nil)
 	if err != nil {
 		if isBadConnError(err) {
-			return nil, driver.ErrBadConn
+			return nil, c.badConn()
 		}
 		return nil, err
 	}
@@ -470,7 +560,7 @@ func (c *OpenAPIConn) BeginTx(ctx context.Context, opts driver.TxOptions) (drive
 	if err != nil {
 		_ = rows.CloseContext(context.Background())
 		if isBadConnError(err) {
-			return nil, driver.ErrBadConn
+			return nil, c.badConn()
 		}
 		return nil, err
 	}
@@ -478,17 +568,28 @@ func (c *OpenAPIConn) BeginTx(ctx context.Context, opts driver.TxOptions) (drive
 	err = rows.CloseContext(ctx)
 	if err != nil {
 		if isBadConnError(err) {
-			return nil, driver.ErrBadConn
+			return nil, c.badConn()
 		}
 		return nil, err
 	}
 
 	c.currentTransaction = s.transaction
 	c.currentTransaction.autocommit = false
+	c.state = ConnInTx
 	return c.currentTransaction, nil
 }
 
 func (c *OpenAPIConn) DisableAutoCommit() error {
+	if err := c.acquire("autocommit"); err != nil {
+		return err
+	}
+	defer c.release()
+
+	return c.disableAutoCommit()
+}
+
+// disableAutoCommit is DisableAutoCommit of acquired connection
+func (c *OpenAPIConn) disableAutoCommit() error {
 	var err error
 
 	if c.currentTransaction != nil {
@@ -497,6 +598,7 @@ func (c *OpenAPIConn) DisableAutoCommit() error {
 		}
 		var nullHandle C.II_PTR = nil
 		_, err = autoCommit(nullHandle, c.currentTransaction.handle)
+		c.endTransaction()
 	}
 
 	c.currentTransaction = nil
@@ -504,48 +606,56 @@ func (c *OpenAPIConn) DisableAutoCommit() error {
 }
 
 // Wait a command to complete
-func wait(genParm *C.IIAPI_GENPARM) {
-	_ = waitContext(context.Background(), genParm, nil)
+func wait(genParm *C.IIAPI_GENPARM) error {
+	return waitContext(context.Background(), genParm, nil)
 }
 
+// setCallback registers the request, the callback reports its completion
+// to waitContext. It should be called before the request is made.
+func setCallback(genParm *C.IIAPI_GENPARM) {
+	C.set_callback(genParm, C.uintptr_t(newRequest()))
+}
+
+// waitContext waits for completion of the request made with setCallback.
+// If the context is done before that, onCancel is called and the request is
+// still waited for, because the API owns genParm until it's completed.
 func waitContext(ctx context.Context, genParm *C.IIAPI_GENPARM, onCancel func()) error {
-	var waitParm C.IIAPI_WAITPARM
-	cancelRequested := false
-	blockingWait := ctx == nil || ctx.Done() == nil
-
-	for genParm.gp_completed == 0 {
-		if !blockingWait && !cancelRequested && ctx != nil {
-			if err := ctx.Err(); err != nil {
-				cancelRequested = true
-				if onCancel != nil {
-					onCancel()
-				}
-			}
-		}
+	id := uintptr(genParm.gp_closure)
+	r, err := issueRequest(id, genParm)
+	if err != nil {
+		return err
+	}
+	defer finishRequest(id)
 
-		if blockingWait {
-			waitParm.wt_timeout = -1
-		} else {
-			waitParm.wt_timeout = 100
-		}
-		C.IIapi_wait(&waitParm)
+	var done <-chan struct{}
+	if ctx != nil {
+		done = ctx.Done()
+	}
 
-		if waitParm.wt_status != C.IIAPI_ST_SUCCESS && waitParm.wt_status != C.IIAPI_ST_WARNING {
-			genParm.gp_status = waitParm.wt_status
-			break
+	cancelRequested := false
+	select {
+	case <-r.done:
+	case <-done:
+		cancelRequested = true
+		if onCancel != nil {
+			onCancel()
 		}
+		<-r.done
 	}
 
-	if cancelRequested && ctx != nil {
-		if err := ctx.Err(); err != nil {
-			return err
-		}
+	if r.failed && genParm.gp_completed == 0 {
+		genParm.gp_status = r.status
 	}
 
+	if cancelRequested {
+		return ctx.Err()
+	}
 	return nil
 }
 
-func fillDesc(desc *C.IIAPI_DESCRIPTOR, val driver.Value) []byte {
+// fillDesc sets up the descriptor of a parameter and returns its value in
+// the server format
+func fillDesc(desc *C.IIAPI_DESCRIPTOR, val driver.Value) ([]byte, error) {
 	var resval []byte
 
 	desc.ds_columnType = C.IIAPI_COL_QPARM
@@ -555,9 +665,74 @@ func fillDesc(desc *C.IIAPI_DESCRIPTOR, val driver.Value) []byte {
 	desc.ds_scale = 0
 
 	switch val.(type) {
+	case nil:
+		// type doesn't matter for NULL, the server coerces it
+		resval = []byte{0}
+		desc.ds_dataType = C.IIAPI_CHA_TYPE
+		desc.ds_nullable = 1
 	case string:
 		resval = []byte(val.(string))
 		desc.ds_dataType = C.IIAPI_CHA_TYPE
+	case NString:
+		units := encodeUTF16(string(val.(NString)))
+		resval = make([]byte, len(units)+2)
+		nativeEndian.PutUint16(resval, uint16(len(units)/2))
+		copy(resval[2:], units)
+		desc.ds_dataType = C.IIAPI_NVCH_TYPE
+	case []byte:
+		b := val.([]byte)
+		if len(b) > math.MaxUint16-2 {
+			return nil, fmt.Errorf("%d bytes don't fit into varbyte", len(b))
+		}
+		resval = make([]byte, len(b)+2)
+		nativeEndian.PutUint16(resval, uint16(len(b)))
+		copy(resval[2:], b)
+		desc.ds_dataType = C.IIAPI_VBYTE_TYPE
+	case bool:
+		resval = []byte{0}
+		if val.(bool) {
+			resval[0] = 1
+		}
+		desc.ds_dataType = C.IIAPI_BOOL_TYPE
+	case time.Time:
+		resval = encodeTimestamp(val.(time.Time))
+		desc.ds_dataType = C.IIAPI_TSTZ_TYPE
+		desc.ds_precision = 9 // keep nanoseconds
+	case time.Duration:
+		resval = encodeIntervalDS(val.(time.Duration))
+		desc.ds_dataType = C.IIAPI_INTDS_TYPE
+		desc.ds_precision = 9 // keep nanoseconds
+	case YearMonthInterval:
+		resval = encodeIntervalYM(val.(YearMonthInterval))
+		desc.ds_dataType = C.IIAPI_INTYM_TYPE
+	case Decimal:
+		var precision, scale int
+		var err error
+
+		resval, precision, scale, err = encodePacked(val.(Decimal))
+		if err != nil {
+			return nil, err
+		}
+		desc.ds_dataType = C.IIAPI_DEC_TYPE
+		desc.ds_precision = C.short(precision)
+		desc.ds_scale = C.short(scale)
+	case UUID:
+		u := val.(UUID)
+		resval = u[:]
+		desc.ds_dataType = C.IIAPI_UUID_TYPE
+	case netip.Addr:
+		addr := val.(netip.Addr)
+		if addr.Is4() {
+			ip := addr.As4()
+			resval = ip[:]
+			desc.ds_dataType = C.IIAPI_IPV4_TYPE
+		} else if addr.Is6() {
+			ip := addr.As16()
+			resval = ip[:]
+			desc.ds_dataType = C.IIAPI_IPV6_TYPE
+		} else {
+			return nil, errors.New("invalid IP address")
+		}
 
 	case int8, int16, int32, int64:
 		var val64 uint64
@@ -575,6 +750,30 @@ func fillDesc(desc *C.IIAPI_DESCRIPTOR, val driver.Value) []byte {
 		resval = make([]byte, 8)
 		nativeEndian.PutUint64(resval, val64)
 
+		desc.ds_dataType = C.IIAPI_INT_TYPE
+	case uint, uint8, uint16, uint32, uint64:
+		var val64 uint64
+
+		switch val.(type) {
+		case uint:
+			val64 = uint64(val.(uint))
+		case uint8:
+			val64 = uint64(val.(uint8))
+		case uint16:
+			val64 = uint64(val.(uint16))
+		case uint32:
+			val64 = uint64(val.(uint32))
+		case uint64:
+			val64 = val.(uint64)
+		}
+
+		// there are no unsigned types, everything goes as integer8
+		if val64 > math.MaxInt64 {
+			return nil, fmt.Errorf("value %d overflows integer8", val64)
+		}
+		resval = make([]byte, 8)
+		nativeEndian.PutUint64(resval, val64)
+
 		desc.ds_dataType = C.IIAPI_INT_TYPE
 	case float32:
 		resval = make([]byte, 4)
@@ -587,11 +786,72 @@ func fillDesc(desc *C.IIAPI_DESCRIPTOR, val driver.Value) []byte {
 
 		desc.ds_dataType = C.IIAPI_FLT_TYPE
 	default:
-		return nil
+		return nil, errors.New("type is not supported")
 	}
 
 	desc.ds_length = C.uint16_t(len(resval))
-	return resval
+	return resval, nil
+}
+
+const (
+	// longer strings and byte slices are sent as long values
+	maxShortParamLen = 32000
+	lobSegmentLen    = 8192
+)
+
+// fillLongDesc sets up a long varchar or long byte descriptor for streams
+// and values that don't fit into a single data value and returns a reader
+// of their content. For everything else it returns nil.
+func fillLongDesc(desc *C.IIAPI_DESCRIPTOR, val driver.Value) io.Reader {
+	var r io.Reader
+
+	switch v := val.(type) {
+	case string:
+		if len(v) <= maxShortParamLen {
+			return nil
+		}
+		r = strings.NewReader(v)
+		desc.ds_dataType = C.IIAPI_LVCH_TYPE
+	case []byte:
+		if len(v) <= maxShortParamLen {
+			return nil
+		}
+		r = bytes.NewReader(v)
+		desc.ds_dataType = C.IIAPI_LBYTE_TYPE
+	case NString:
+		// there are never more UTF-16 units than UTF-8 bytes
+		if len(v)*2 <= maxShortParamLen {
+			return nil
+		}
+		units := encodeUTF16(string(v))
+		if len(units) <= maxShortParamLen {
+			return nil
+		}
+		r = bytes.NewReader(units)
+		desc.ds_dataType = C.IIAPI_LNVCH_TYPE
+	case LOBStream:
+		if v.Reader == nil {
+			return nil
+		}
+		r = v.Reader
+		desc.ds_dataType = C.IIAPI_LBYTE_TYPE
+		if v.Text {
+			desc.ds_dataType = C.IIAPI_LVCH_TYPE
+		}
+	case io.Reader:
+		r = v
+		desc.ds_dataType = C.IIAPI_LBYTE_TYPE
+	default:
+		return nil
+	}
+
+	desc.ds_columnType = C.IIAPI_COL_QPARM
+	desc.ds_columnName = nil
+	desc.ds_nullable = 0
+	desc.ds_precision = 0
+	desc.ds_scale = 0
+	desc.ds_length = C.uint16_t(lobSegmentLen + 2)
+	return r
 }
 
 func formatSQLLiteral(v driver.Value) (string, error) {
@@ -602,6 +862,8 @@ func formatSQLLiteral(v driver.Value) (string, error) {
 	switch x := v.(type) {
 	case string:
 		return "'" + strings.ReplaceAll(x, "'", "''") + "'", nil
+	case NString:
+		return "N'" + strings.ReplaceAll(string(x), "'", "''") + "'", nil
 	case []byte:
 		return "'" + strings.ReplaceAll(string(x), "'", "''") + "'", nil
 	case int:
@@ -618,6 +880,8 @@ func formatSQLLiteral(v driver.Value) (string, error) {
 		return strconv.FormatFloat(float64(x), 'g', -1, 32), nil
 	case float64:
 		return strconv.FormatFloat(x, 'g', -1, 64), nil
+	case Decimal:
+		return x.String(), nil
 	case bool:
 		if x {
 			return "true", nil
@@ -650,15 +914,21 @@ func inlineTildeArgs(query string, args []driver.Value) (string, error) {
 	return out, nil
 }
 
-func (s *stmt) sendArgs(ctx context.Context, stmtHandle C.II_PTR) error {
+// sendArgs sends service parameters svc followed by the statement arguments
+func (s *stmt) sendArgs(ctx context.Context, stmtHandle C.II_PTR, svc []driver.Value) error {
 	var err error
 	var cols *C.IIAPI_DATAVALUE
 	var descs *C.IIAPI_DESCRIPTOR
 
 	var vals [][]byte
+	var names []*C.char
 
 	/* cleanup everything at the end */
 	defer func() {
+		for _, name := range names {
+			C.free(unsafe.Pointer(name))
+		}
+
 		if cols != nil {
 			C.free(unsafe.Pointer(cols))
 		}
@@ -672,11 +942,11 @@ func (s *stmt) sendArgs(ctx context.Context, stmtHandle C.II_PTR) error {
 		}
 	}()
 
-	if s.args == nil || len(s.args) == 0 {
+	if len(s.args)+len(svc) == 0 {
 		return nil
 	}
 
-	args := s.args
+	args := append(append([]driver.Value{}, svc...), s.args...)
 
 	var descrParm C.IIAPI_SETDESCRPARM
 
@@ -689,19 +959,55 @@ func (s *stmt) sendArgs(ctx context.Context, stmtHandle C.II_PTR) error {
 
 	cols = C.allocate_cols(descrParm.sd_descriptorCount)
 	vals = make([][]byte, len(args))
+	long := make([]io.Reader, len(args))
 
 	for i, arg := range args {
-		val := fillDesc(C.get_desc(descs, C.ushort(i)), arg)
-		if val == nil {
-			return errors.New("parameter conversion error")
+		desc := C.get_desc(descs, C.ushort(i))
+
+		if i < len(svc) {
+			vals[i], err = fillSvcDesc(desc, arg)
+			if err != nil {
+				return err
+			}
+			C.set_dv_value(cols, C.int(i), unsafe.Pointer(&vals[i][0]))
+			C.set_dv_length(cols, C.int(i), C.ushort(len(vals[i])))
+			C.set_dv_null(cols, C.int(i), 0)
+			continue
+		}
+
+		if str, ok := arg.(string); ok && s.conn.params.NVarchar {
+			arg = NString(str)
+		}
+
+		if r := fillLongDesc(desc, arg); r != nil {
+			// sent later segment by segment
+			long[i] = r
+			continue
+		}
+
+		val, err := fillDesc(desc, arg)
+		if err != nil {
+			return fmt.Errorf("argument %d (%T): %w", i-len(svc)+1, arg, err)
 		}
 
 		vals[i] = val
-		C.set_dv_value(cols, C.int(i), unsafe.Pointer(&vals[i][0]))
+		if len(val) > 0 {
+			C.set_dv_value(cols, C.int(i), unsafe.Pointer(&vals[i][0]))
+		} else {
+			C.set_dv_value(cols, C.int(i), nil)
+		}
 		C.set_dv_length(cols, C.int(i), C.ushort(len(val)))
-		C.set_dv_null(cols, C.int(i), 0)
+
+		// only NULL values get nullable descriptors
+		C.set_dv_null(cols, C.int(i), desc.ds_nullable)
 	}
 
+	for i := range s.procParams {
+		desc := C.get_desc(descs, C.ushort(len(svc)+i))
+		names = append(names, s.setProcDesc(desc, i))
+	}
+
+	setCallback(&descrParm.sd_genParm)
 	C.IIapi_setDescriptor(&descrParm)
 	err = waitContext(ctx, &descrParm.sd_genParm, func() {
 		_ = cancelStmt(stmtHandle)
@@ -714,47 +1020,150 @@ func (s *stmt) sendArgs(ctx context.Context, stmtHandle C.II_PTR) error {
 		return err
 	}
 
+	/* like with reading, parameters are sent by parts: runs of short
+	   parameters go in one call, and each long parameter is sent in
+	   separate calls, one segment per call
+	*/
+	start := 0
+	for i := 0; i <= len(args); i++ {
+		if i < len(args) && long[i] == nil {
+			continue
+		}
+
+		if i > start {
+			err = putParms(ctx, stmtHandle, C.get_dv(cols, C.ushort(start)), i-start, false)
+			if err != nil {
+				return err
+			}
+		}
+
+		if i < len(args) {
+			unit := 1
+			if C.get_desc(descs, C.ushort(i)).ds_dataType == C.IIAPI_LNVCH_TYPE {
+				unit = 2
+			}
+
+			err = putLongParm(ctx, stmtHandle, C.get_dv(cols, C.ushort(i)), long[i], unit)
+			if err != nil {
+				return err
+			}
+		}
+		start = i + 1
+	}
+
+	return nil
+}
+
+func putParms(ctx context.Context, stmtHandle C.II_PTR, parms *C.IIAPI_DATAVALUE,
+	count int, moreSegments bool) error {
 	var putParm C.IIAPI_PUTPARMPARM
-	putParm.pp_stmtHandle = stmtHandle
-	putParm.pp_parmCount = descrParm.sd_descriptorCount
-	putParm.pp_parmData = cols
 
-	//TODO: segments support
+	setCallback(&putParm.pp_genParm)
+	putParm.pp_stmtHandle = stmtHandle
+	putParm.pp_parmCount = C.short(count)
+	putParm.pp_parmData = parms
 	putParm.pp_moreSegments = 0
+	if moreSegments {
+		putParm.pp_moreSegments = 1
+	}
 
 	C.IIapi_putParms(&putParm)
-	err = waitContext(ctx, &putParm.pp_genParm, func() {
+	err := waitContext(ctx, &putParm.pp_genParm, func() {
 		_ = cancelStmt(stmtHandle)
 	})
 	if err != nil {
 		return err
 	}
-	err = checkError("IIapi_putParms()", &putParm.pp_genParm)
+	return checkError("IIapi_putParms()", &putParm.pp_genParm)
+}
+
+// putLongParm sends content of r in segments, every segment starts with two
+// bytes of its length in units (2 bytes for long nvarchar) like varchar
+// values
+func putLongParm(ctx context.Context, stmtHandle C.II_PTR, dv *C.IIAPI_DATAVALUE,
+	r io.Reader, unit int) error {
+	return putSegments(stmtHandle, dv, r, unit, func(more bool) error {
+		return putParms(ctx, stmtHandle, dv, 1, more)
+	})
+}
+
+// putSegments sets dv to every segment of r and sends it with put, more is
+// false for the last segment
+func putSegments(stmtHandle C.II_PTR, dv *C.IIAPI_DATAVALUE, r io.Reader, unit int,
+	put func(more bool) error) error {
+	// the next segment is read ahead to know if the current one is the last
+	segment := make([]byte, lobSegmentLen+2)
+	next := make([]byte, lobSegmentLen+2)
+
+	n, err := readSegment(r, segment, unit)
 	if err != nil {
 		return err
 	}
 
-	return nil
-}
+	for {
+		var nextN int
 
-func (s *stmt) runQuery(ctx context.Context, transHandle C.II_PTR) (*rows, error) {
-	var err error
-	var stmtHandle C.II_PTR
-	var colBlocks colGetBlocks
+		if n > 0 {
+			nextN, err = readSegment(r, next, unit)
+			if err != nil {
+				// the server waits for the rest of the value
+				_ = cancelStmt(stmtHandle)
+				return err
+			}
+		}
 
-	defer func() {
+		dv.dv_null = 0
+		dv.dv_length = C.uint16_t(n + 2)
+		dv.dv_value = C.II_PTR(unsafe.Pointer(&segment[0]))
+
+		err = put(nextN > 0)
 		if err != nil {
-			closeStmt(stmtHandle)
-			colBlocks.free()
+			return err
 		}
-	}()
 
-	var queryParm C.IIAPI_QUERYPARM
-	var getDescrParm C.IIAPI_GETDESCRPARM
+		if nextN == 0 {
+			return nil
+		}
+		segment, next = next, segment
+		n = nextN
+	}
+}
+
+// readSegment fills segment after its length prefix, returns 0 at the end
+// of the stream
+func readSegment(r io.Reader, segment []byte, unit int) (int, error) {
+	n, err := io.ReadFull(r, segment[2:])
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+
+	nativeEndian.PutUint16(segment, uint16(n/unit))
+	return n, err
+}
+
+// encodeUTF16 returns s as UTF-16 in native byte order
+func encodeUTF16(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	res := make([]byte, len(units)*2)
+	for i, u := range units {
+		nativeEndian.PutUint16(res[i*2:], u)
+	}
+	return res
+}
+
+func (s *stmt) runQuery(ctx context.Context, transHandle C.II_PTR) (*rows, error) {
+	if s.proc != nil {
+		return s.runProcedure(ctx, transHandle)
+	}
+
 	queryText := s.query
 	sendArgs := len(s.args) > 0
 
-	if sendArgs && strings.Contains(queryText, "~V") {
+	// prepared statements take ~V values as parameters
+	preparedText, preparedType := s.preparedQuery(queryText)
+	prepared := preparedText != queryText
+
+	if sendArgs && !prepared && strings.Contains(queryText, "~V") {
 		inlinedQuery, inlineErr := inlineTildeArgs(queryText, s.args)
 		if inlineErr != nil {
 			return nil, inlineErr
@@ -764,17 +1173,100 @@ func (s *stmt) runQuery(ctx context.Context, transHandle C.II_PTR) (*rows, error
 		s.args = nil
 	}
 
-	queryParm.qy_genParm.gp_callback = nil
-	queryParm.qy_genParm.gp_closure = nil
+	if s.cursorHandle != nil {
+		// the cursor is passed as a service parameter
+		return s.startQuery(ctx, transHandle, queryRequest{
+			text:      queryText,
+			queryType: s.cursorOp,
+			sendArgs:  sendArgs,
+			svcParms:  []driver.Value{s.cursorHandle},
+		})
+	}
+
+	queryType := s.queryType
+	if prepared {
+		queryText, queryType = preparedText, preparedType
+	}
+
+	if queryType == s.queryType && sendArgs && s.isRepeatable(queryText) {
+		return s.runRepeatQuery(ctx, transHandle, queryText)
+	}
+
+	req := queryRequest{
+		text:      queryText,
+		queryType: queryType,
+		sendArgs:  sendArgs,
+		describe:  s.queryType != EXEC,
+		fetchRows: s.conn.fetchRows(ctx),
+	}
+
+	res, err := s.startQuery(ctx, transHandle, req)
+	if prepared && isInvalidStmtName(err) && !hasStreamArgs(s.args) {
+		// the statement was discarded at the end of a transaction
+		p := s.prepared
+		if err = s.conn.prepareStmt(ctx, p.name, p.text); err != nil {
+			return nil, err
+		}
+		res, err = s.startQuery(ctx, transHandle, req)
+	}
+	return res, err
+}
+
+func hasStreamArgs(args []driver.Value) bool {
+	for _, arg := range args {
+		if isStreamArg(arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// queryRequest describes IIapi_query call made by startQuery
+type queryRequest struct {
+	text      string // could be empty for repeat queries
+	queryType QueryType
+	sendArgs  bool
+	svcParms  []driver.Value // service parameters sent before arguments
+	describe  bool           // get result descriptors
+	scroll    bool           // open scrollable cursor
+	fetchRows int            // rows fetched at once, one if not set
+}
+
+// startQuery runs the query, sends arguments and gets descriptors of the
+// result
+func (s *stmt) startQuery(ctx context.Context, transHandle C.II_PTR, req queryRequest) (*rows, error) {
+	var err error
+	var stmtHandle C.II_PTR
+	var colBlocks colGetBlocks
+
+	defer func() {
+		if err != nil {
+			closeStmt(stmtHandle)
+			colBlocks.free()
+		}
+	}()
+
+	var queryParm C.IIAPI_QUERYPARM
+	var getDescrParm C.IIAPI_GETDESCRPARM
+
+	setCallback(&queryParm.qy_genParm)
 	queryParm.qy_connHandle = s.conn.handle
-	queryParm.qy_queryType = C.uint(s.queryType)
-	queryParm.qy_queryText = C.CString(queryText)
-	defer C.free(unsafe.Pointer(queryParm.qy_queryText))
+	queryParm.qy_queryType = C.uint(req.queryType)
+	queryParm.qy_queryText = nil
+	if req.text != "" {
+		queryParm.qy_queryText = C.CString(req.text)
+		defer C.free(unsafe.Pointer(queryParm.qy_queryText))
+	}
 	queryParm.qy_parameters = 0
 	queryParm.qy_tranHandle = transHandle
 	queryParm.qy_stmtHandle = nil
+	queryParm.qy_flags = C.IIAPI_QF_NONE
+
+	if req.scroll {
+		queryParm.qy_flags = C.IIAPI_QF_SCROLL
+	}
 
-	if sendArgs {
+	if req.sendArgs || len(req.svcParms) > 0 {
 		queryParm.qy_parameters = 1
 	}
 
@@ -798,6 +1290,7 @@ func (s *stmt) runQuery(ctx context.Context, transHandle C.II_PTR) (*rows, error
 		transactionCreated: transHandle == nil,
 		stmtHandle:         stmtHandle,
 		queryType:          s.queryType,
+		txSeq:              s.conn.txSeq,
 	}
 
 	nextTranHandle := queryParm.qy_tranHandle
@@ -813,8 +1306,8 @@ func (s *stmt) runQuery(ctx context.Context, transHandle C.II_PTR) (*rows, error
 		s.conn.currentTransaction.handle = nextTranHandle
 	}
 
-	if sendArgs {
-		err = s.sendArgs(ctx, res.stmtHandle)
+	if req.sendArgs || len(req.svcParms) > 0 {
+		err = s.sendArgs(ctx, res.stmtHandle, req.svcParms)
 		if err != nil {
 			return nil, err
 		}
@@ -823,9 +1316,8 @@ func (s *stmt) runQuery(ctx context.Context, transHandle C.II_PTR) (*rows, error
 	}
 
 	// Get query result descriptors.
-	if s.queryType != EXEC {
-		getDescrParm.gd_genParm.gp_callback = nil
-		getDescrParm.gd_genParm.gp_closure = nil
+	if req.describe {
+		setCallback(&getDescrParm.gd_genParm)
 		getDescrParm.gd_stmtHandle = res.stmtHandle
 		getDescrParm.gd_descriptorCount = 0
 		getDescrParm.gd_descriptor = nil
@@ -843,104 +1335,169 @@ func (s *stmt) runQuery(ctx context.Context, transHandle C.II_PTR) (*rows, error
 			return nil, err
 		}
 
-		res.colTyps = make([]columnDesc, getDescrParm.gd_descriptorCount)
-		res.colNames = make([]string, getDescrParm.gd_descriptorCount)
-		res.vals = make([][]byte, len(res.colTyps))
-		res.nulls = make([]bool, len(res.colTyps))
-
-		for i := 0; i < len(res.colTyps); i++ {
-			descr := C.get_descr(&getDescrParm, C.ulong(i))
-			res.colTyps[i].ingDataType = descr.ds_dataType
-			res.colTyps[i].nullable = (descr.ds_nullable == 1)
-			res.colTyps[i].length = uint16(descr.ds_length)
-			res.colTyps[i].precision = int16(descr.ds_precision)
-			res.colTyps[i].scale = int16(descr.ds_scale)
+		res.setColumns(int(getDescrParm.gd_descriptorCount), func(i int) *C.IIAPI_DESCRIPTOR {
+			return C.get_descr(&getDescrParm, C.ulong(i))
+		})
 
-			res.colNames[i] = C.GoString(descr.ds_columnName)
-			res.vals[i] = make([]byte, res.colTyps[i].length)
-			res.nulls[i] = false
+		if len(res.colTyps) == 0 {
+			// the statement doesn't return rows
+			err = res.fetchInfoContext(ctx)
+			if err != nil {
+				return nil, err
+			}
+			res.done = true
 		}
 
-		newColBlock := func(start, end uint16, segmented bool) *colBlock {
-			var i uint16
+		colBlocks = res.makeColBlocks(req.fetchRows, s.conn.params.StreamLOBs)
+	}
 
-			count := end - start + 1
-			if count <= 0 {
-				return nil
-			}
+	res.colBlocks = colBlocks
+	return res, nil
+}
 
-			block := &colBlock{
-				count:     count,
-				cols:      C.allocate_cols(C.short(count)),
-				segmented: segmented,
-				nulls:     make([]*bool, count),
-			}
+// setColumns sets descriptors of the result columns and allocates buffers
+// for their values
+func (res *rows) setColumns(count int, descr func(i int) *C.IIAPI_DESCRIPTOR) {
+	res.colTyps = make([]columnDesc, count)
+	res.colNames = make([]string, count)
+	res.vals = make([][]byte, count)
+	res.nulls = make([]bool, count)
 
-			// save link to the block for decoding
+	for i := 0; i < count; i++ {
+		descr := descr(i)
+		res.colTyps[i].ingDataType = descr.ds_dataType
+		res.colTyps[i].nullable = (descr.ds_nullable == 1)
+		res.colTyps[i].length = uint16(descr.ds_length)
+		res.colTyps[i].precision = int16(descr.ds_precision)
+		res.colTyps[i].scale = int16(descr.ds_scale)
 
-			if segmented {
-				block.colIndex = start
-				block.buffer = bufferPool.Get().(*bytes.Buffer)
-				res.colTyps[start].block = block
-			}
+		res.colNames[i] = C.GoString(descr.ds_columnName)
+		res.vals[i] = make([]byte, res.colTyps[i].length)
+		res.nulls[i] = false
+	}
+}
+
+// makeColBlocks divides the columns into blocks fetched by one
+// IIapi_getColumns call
+func (res *rows) makeColBlocks(fetchRows int, streamLOBs bool) colGetBlocks {
+	var colBlocks colGetBlocks
+
+	newColBlock := func(start, end uint16, segmented bool, rowCount uint16) *colBlock {
+		var i, r uint16
 
+		count := end - start + 1
+		if count <= 0 {
+			return nil
+		}
+
+		block := &colBlock{
+			count:     count,
+			rowCount:  rowCount,
+			cols:      C.allocate_cols(C.short(count * rowCount)),
+			segmented: segmented,
+			nulls:     make([]*bool, count*rowCount),
+		}
+
+		// save link to the block for decoding
+
+		if segmented {
+			block.colIndex = start
+			block.buffer = bufferPool.Get().(*bytes.Buffer)
+			res.colTyps[start].block = block
+		}
+
+		if rowCount > 1 {
+			res.batch = newRowBatch(block)
+		}
+
+		for r = 0; r < rowCount; r++ {
 			for i = 0; i < count; i++ {
 				j := start + i
-				C.set_dv_length(block.cols, C.int(i), C.uint16_t(res.colTyps[i].length))
-				C.set_dv_value(block.cols, C.int(i), unsafe.Pointer(&res.vals[j][0]))
-				block.nulls[i] = &res.nulls[j]
+				k := r*count + i
+
+				val, null := res.vals[j], &res.nulls[j]
+				if res.batch != nil {
+					// the first row reuses the buffers of rows
+					if r > 0 {
+						val = make([]byte, len(val))
+					}
+					res.batch.vals[k] = val
+					null = &res.batch.nulls[k]
+				}
+
+				C.set_dv_length(block.cols, C.int(k), C.uint16_t(res.colTyps[j].length))
+				C.set_dv_value(block.cols, C.int(k), unsafe.Pointer(&val[0]))
+				block.nulls[k] = null
 			}
-			return block
 		}
+		return block
+	}
 
-		var start = uint16(0)
-		var current = uint16(0)
-
-		for current < uint16(len(res.colTyps)) {
-			if res.colTyps[current].isLongType() {
-				b := newColBlock(start, current-1, false)
-				if b != nil {
-					colBlocks = append(colBlocks, b)
-				}
+	var start = uint16(0)
+	var current = uint16(0)
 
-				colBlocks = append(colBlocks, newColBlock(current, current, true))
-				start = current + 1
+	for current < uint16(len(res.colTyps)) {
+		if res.colTyps[current].isLongType() {
+			b := newColBlock(start, current-1, false, 1)
+			if b != nil {
+				colBlocks = append(colBlocks, b)
 			}
-			current += 1
+
+			colBlocks = append(colBlocks, newColBlock(current, current, true, 1))
+			start = current + 1
 		}
+		current += 1
+	}
 
-		b := newColBlock(start, current-1, false)
-		if b != nil {
-			colBlocks = append(colBlocks, b)
+	// rows without long columns are fetched in batches
+	rowCount := uint16(1)
+	if start == 0 && current > 0 {
+		rowSize := 0
+		for _, col := range res.colTyps {
+			rowSize += int(col.length)
 		}
+		rowCount = batchRowCount(fetchRows, current, rowSize)
 	}
 
-	res.colBlocks = colBlocks
-	return res, nil
+	b := newColBlock(start, current-1, false, rowCount)
+	if b != nil {
+		colBlocks = append(colBlocks, b)
+	}
+
+	// only a trailing long column can be streamed, all other columns
+	// have to be fetched before Next returns
+	if streamLOBs && len(colBlocks) > 0 {
+		last := colBlocks[len(colBlocks)-1]
+		last.streamed = last.segmented
+	}
+
+	return colBlocks
 }
 
 func rollbackTransaction(tranHandle C.II_PTR) error {
 	var rollbackParm C.IIAPI_ROLLBACKPARM
 
-	rollbackParm.rb_genParm.gp_callback = nil
-	rollbackParm.rb_genParm.gp_closure = nil
+	setCallback(&rollbackParm.rb_genParm)
 	rollbackParm.rb_tranHandle = tranHandle
 	rollbackParm.rb_savePointHandle = nil
 
 	C.IIapi_rollback(&rollbackParm)
-	wait(&rollbackParm.rb_genParm)
+	if err := wait(&rollbackParm.rb_genParm); err != nil {
+		return err
+	}
 	return checkError("IIapi_rollback", &rollbackParm.rb_genParm)
 }
 
 func commitTransaction(tranHandle C.II_PTR) error {
 	var commitParm C.IIAPI_COMMITPARM
 
-	commitParm.cm_genParm.gp_callback = nil
-	commitParm.cm_genParm.gp_closure = nil
+	setCallback(&commitParm.cm_genParm)
 	commitParm.cm_tranHandle = tranHandle
 
 	C.IIapi_commit(&commitParm)
-	wait(&commitParm.cm_genParm)
+	if err := wait(&commitParm.cm_genParm); err != nil {
+		return err
+	}
 	return checkError("IIapi_commit", &commitParm.cm_genParm)
 }
 
@@ -1051,6 +1608,10 @@ func (c *columnDesc) splitLenVal(val []byte) (uint16, []byte) {
 }
 
 func (c *columnDesc) getType() reflect.Type {
+	if c.block != nil && c.block.streamed {
+		return reflect.TypeOf((*LOBReader)(nil))
+	}
+
 	switch c.ingDataType {
 	case
 		C.IIAPI_CHR_TYPE,
@@ -1085,15 +1646,16 @@ func (c *columnDesc) getType() reflect.Type {
 	case
 		C.IIAPI_MNY_TYPE, /* Money */
 		C.IIAPI_DEC_TYPE: /* Decimal */
-		return reflect.TypeOf("")
+		return reflect.TypeOf(Decimal{})
 	case
 		C.IIAPI_BOOL_TYPE: /* Boolean */
 		return reflect.TypeOf(false)
+	case C.IIAPI_UUID_TYPE: /* UUID */
+		return reflect.TypeOf(UUID{})
 	case
-		C.IIAPI_UUID_TYPE, /* UUID */
 		C.IIAPI_IPV4_TYPE, /* IPv4 */
 		C.IIAPI_IPV6_TYPE: /* IPv6 */
-		return reflect.TypeOf([]byte(nil))
+		return reflect.TypeOf(IPAddr{})
 	case
 		C.IIAPI_DTE_TYPE,  /* Ingres Date */
 		C.IIAPI_DATE_TYPE, /* ANSI Date */
@@ -1104,8 +1666,9 @@ func (c *columnDesc) getType() reflect.Type {
 		C.IIAPI_TSWO_TYPE, /* Timestamp without Timezone */
 		C.IIAPI_TSTZ_TYPE: /* Timestamp with Timezone */
 		return reflect.TypeOf(time.Time{})
-	case C.IIAPI_INTYM_TYPE, /* Interval Year to Month */
-		C.IIAPI_INTDS_TYPE: /* Interval Day to Second */
+	case C.IIAPI_INTYM_TYPE: /* Interval Year to Month */
+		return reflect.TypeOf(YearMonthInterval{})
+	case C.IIAPI_INTDS_TYPE: /* Interval Day to Second */
 		return reflect.TypeOf(time.Duration(0))
 	}
 	return reflect.TypeOf([]byte(nil))
@@ -1211,8 +1774,7 @@ func closeStmtContext(ctx context.Context, stmtHandle C.II_PTR) error {
 		runClose := func() error {
 			var closeParm C.IIAPI_CLOSEPARM
 
-			closeParm.cl_genParm.gp_callback = nil
-			closeParm.cl_genParm.gp_closure = nil
+			setCallback(&closeParm.cl_genParm)
 			closeParm.cl_stmtHandle = stmtHandle
 
 			C.IIapi_close(&closeParm)
@@ -1248,12 +1810,13 @@ func cancelStmt(stmtHandle C.II_PTR) error {
 
 	var cancelParm C.IIAPI_CANCELPARM
 
-	cancelParm.cn_genParm.gp_callback = nil
-	cancelParm.cn_genParm.gp_closure = nil
+	setCallback(&cancelParm.cn_genParm)
 	cancelParm.cn_stmtHandle = stmtHandle
 
 	C.IIapi_cancel(&cancelParm)
-	wait(&cancelParm.cn_genParm)
+	if err := wait(&cancelParm.cn_genParm); err != nil {
+		return err
+	}
 
 	err := checkError("IIapi_cancel()", &cancelParm.cn_genParm)
 	if err != nil && strings.Contains(err.Error(), "Query cancelled.") {
@@ -1264,6 +1827,10 @@ func cancelStmt(stmtHandle C.II_PTR) error {
 }
 
 func (s *stmt) Close() error {
+	s.conn.mu.Lock()
+	defer s.conn.mu.Unlock()
+
+	s.closePrepared()
 	return nil
 }
 
@@ -1275,6 +1842,11 @@ func (b colGetBlocks) free() {
 			block.cols = nil
 		}
 
+		if block.lob != nil {
+			block.lob.closed = true
+			block.lob = nil
+		}
+
 		// reuse buffers
 		if block.buffer != nil {
 			bufferPool.Put(block.buffer)
@@ -1284,13 +1856,38 @@ func (b colGetBlocks) free() {
 }
 
 func (rs *rows) Close() error {
-	return rs.CloseContext(context.Background())
+	return rs.closeConn(context.Background())
+}
+
+// closeConn closes the rows in any state of the connection, C resources are
+// freed even if the connection is closed
+func (rs *rows) closeConn(ctx context.Context) error {
+	c := rs.stmt.conn
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.handle == nil {
+		// the statement has gone with the connection
+		c.endQuery(rs)
+		rs.unregisterCursor()
+		rs.stmtHandle = nil
+		rs.colBlocks.free()
+		return c.stateError("close", ErrConnBroken)
+	}
+
+	if rs.txSeq != c.txSeq {
+		// the server has closed the cursor with its transaction
+		rs.done = true
+	}
+	return rs.CloseContext(ctx)
 }
 
 func (rs *rows) CloseContext(ctx context.Context) error {
 	if finish := rs.finish; finish != nil {
 		defer finish()
 	}
+	defer rs.stmt.conn.endQuery(rs)
+	rs.unregisterCursor()
 
 	if rs.stmtHandle != nil && rs.queryType != EXEC && !rs.done {
 		for !rs.done {
@@ -1298,6 +1895,8 @@ func (rs *rows) CloseContext(ctx context.Context) error {
 			if err != nil {
 				cancelErr := cancelStmt(rs.stmtHandle)
 				if cancelErr != nil {
+					// the statement can't be finished
+					rs.stmt.conn.state = ConnBroken
 					return cancelErr
 				}
 				break
@@ -1314,7 +1913,8 @@ func (rs *rows) CloseContext(ctx context.Context) error {
 	// free C allocated arrays
 	rs.colBlocks.free()
 
-	return err
+	// the return value of a procedure which rows were not read to the end
+	return rs.assignProcOutputs()
 }
 
 // Gets a new row
@@ -1324,13 +1924,23 @@ func (rs *rows) fetchData() error {
 
 func (rs *rows) fetchDataContext(ctx context.Context) error {
 	var err error
-	var getColParm C.IIAPI_GETCOLPARM
+	var noData bool
 
 	if rs.done {
 		// do nothing
 		return nil
 	}
 
+	if rs.batch != nil {
+		return rs.nextBatchRow(ctx)
+	}
+
+	// the rest of streamed column from the previous row is not needed
+	err = rs.discardLOB(ctx)
+	if err != nil {
+		return err
+	}
+
 	for i := 0; i < len(rs.nulls); i++ {
 		rs.nulls[i] = false
 	}
@@ -1340,35 +1950,18 @@ func (rs *rows) fetchDataContext(ctx context.Context) error {
 			block.buffer.Reset()
 		}
 
-		getColParm.gc_genParm.gp_callback = nil
-		getColParm.gc_genParm.gp_closure = nil
-		getColParm.gc_rowCount = 1
-		getColParm.gc_columnCount = C.short(block.count)
-		getColParm.gc_columnData = block.cols
-		getColParm.gc_stmtHandle = rs.stmtHandle
-
 		for {
-			getColParm.gc_moreSegments = 0
-
-			C.IIapi_getColumns(&getColParm)
-			err = waitContext(ctx, &getColParm.gc_genParm, func() {
-				_ = cancelStmt(rs.stmtHandle)
-			})
-			if err != nil {
-				return err
-			}
-			err = checkError("IIapi_getColumns()", &getColParm.gc_genParm)
+			var more bool
 
+			more, noData, err = rs.getColumns(ctx, block)
 			if err != nil {
 				return err
 			}
 
-			var i uint16
-			for i = 0; i < block.count; i++ {
-				dv := C.get_dv(block.cols, C.ushort(i))
-				if dv.dv_null == 1 {
-					*block.nulls[i] = true
-				}
+			if block.streamed {
+				// only the first segment, others are read by LOBReader
+				block.lob = newLOBStream(rs, block, more)
+				break
 			}
 
 			if block.segmented {
@@ -1382,13 +1975,13 @@ func (rs *rows) fetchDataContext(ctx context.Context) error {
 				}
 			}
 
-			if getColParm.gc_moreSegments == 0 {
+			if !more {
 				break
 			}
 		}
 	}
 
-	if getColParm.gc_genParm.gp_status == C.IIAPI_ST_NO_DATA {
+	if noData {
 		rs.done = true
 	}
 
@@ -1399,6 +1992,48 @@ func (rs *rows) fetchDataContext(ctx context.Context) error {
 	return err
 }
 
+// getColumns gets values of the block columns for rowCount rows, for
+// segmented block only the next segment is read
+func (rs *rows) getColumns(ctx context.Context, block *colBlock) (moreSegments bool, noData bool, err error) {
+	var getColParm C.IIAPI_GETCOLPARM
+
+	setCallback(&getColParm.gc_genParm)
+	getColParm.gc_rowCount = C.II_INT2(block.rowCount)
+	getColParm.gc_columnCount = C.short(block.count)
+	getColParm.gc_columnData = block.cols
+	getColParm.gc_stmtHandle = rs.stmtHandle
+	getColParm.gc_moreSegments = 0
+
+	C.IIapi_getColumns(&getColParm)
+	err = waitContext(ctx, &getColParm.gc_genParm, func() {
+		_ = cancelStmt(rs.stmtHandle)
+	})
+	if err != nil {
+		return false, false, err
+	}
+	err = checkError("IIapi_getColumns()", &getColParm.gc_genParm)
+	if err != nil {
+		return false, false, err
+	}
+
+	block.rowsReturned = uint16(getColParm.gc_rowsReturned)
+
+	n := block.count
+	if block.rowCount > 1 {
+		n *= block.rowsReturned
+	}
+
+	var i uint16
+	for i = 0; i < n; i++ {
+		dv := C.get_dv(block.cols, C.ushort(i))
+		if dv.dv_null == 1 {
+			*block.nulls[i] = true
+		}
+	}
+
+	return getColParm.gc_moreSegments != 0, getColParm.gc_genParm.gp_status == C.IIAPI_ST_NO_DATA, nil
+}
+
 func (rs *rows) fetchInfo() error {
 	return rs.fetchInfoContext(context.Background())
 }
@@ -1411,8 +2046,11 @@ func (rs *rows) fetchInfoContext(ctx context.Context) error {
 		return errors.New("statement is already closed")
 	}
 
-	getQInfoParm.gq_genParm.gp_callback = nil
-	getQInfoParm.gq_genParm.gp_closure = nil
+	if rs.infoFetched {
+		return nil
+	}
+
+	setCallback(&getQInfoParm.gq_genParm)
 	getQInfoParm.gq_stmtHandle = rs.stmtHandle
 
 	info := &getQInfoParm
@@ -1429,7 +2067,21 @@ func (rs *rows) fetchInfoContext(ctx context.Context) error {
 		return err
 	}
 
+	if info.gq_flags&C.IIAPI_GQF_UNKNOWN_REPEAT_QUERY != 0 {
+		return errUnknownRepeatQuery
+	}
+
+	if info.gq_mask&C.IIAPI_GQ_PROCEDURE_RET != 0 {
+		rs.procReturn = int64(info.gq_procedureReturn)
+		rs.hasProcReturn = true
+	}
+
+	if info.gq_mask&C.IIAPI_GQ_REPEAT_QUERY_ID != 0 {
+		rs.repeatHandle = info.gq_repeatQueryHandle
+	}
+
 	rs.rowsAffected = int64(info.gq_rowCountEx)
+	rs.infoFetched = true
 	return nil
 }
 
@@ -1473,6 +2125,9 @@ func decode(col *columnDesc, val []byte) (driver.Value, error) {
 		if col.block == nil {
 			return nil, errors.New("internal: long types should have a link to column block")
 		}
+		if col.block.streamed {
+			return &LOBReader{lob: col.block.lob}, nil
+		}
 
 		// TODO: optimize here, shrink at the end for \0
 		val = col.block.buffer.Bytes()
@@ -1487,6 +2142,9 @@ func decode(col *columnDesc, val []byte) (driver.Value, error) {
 		if col.block == nil {
 			return nil, errors.New("internal: long types should have a link to column block")
 		}
+		if col.block.streamed {
+			return &LOBReader{lob: col.block.lob}, nil
+		}
 
 		res = col.block.buffer.Bytes()
 	case C.IIAPI_NVCH_TYPE, C.IIAPI_NCHA_TYPE:
@@ -1497,6 +2155,13 @@ func decode(col *columnDesc, val []byte) (driver.Value, error) {
 		res = string(utf16.Decode(out))
 		res = shrinkStr(res.(string))
 	case C.IIAPI_LNVCH_TYPE:
+		if col.block == nil {
+			return nil, errors.New("internal: long types should have a link to column block")
+		}
+		if col.block.streamed {
+			return &LOBReader{lob: col.block.lob}, nil
+		}
+
 		val = col.block.buffer.Bytes()
 		out := make([]uint16, len(val)/2)
 		for i := range out {
@@ -1504,25 +2169,73 @@ func decode(col *columnDesc, val []byte) (driver.Value, error) {
 		}
 		res = string(utf16.Decode(out))
 		res = shrinkStr(res.(string))
-	case
-		C.IIAPI_DEC_TYPE,   /* Decimal */
-		C.IIAPI_DTE_TYPE,   /* Ingres Date */
-		C.IIAPI_DATE_TYPE,  /* ANSI Date */
-		C.IIAPI_TIME_TYPE,  /* Ingres Time */
-		C.IIAPI_TMWO_TYPE,  /* Time without Timezone */
-		C.IIAPI_TMTZ_TYPE,  /* Time with Timezone */
-		C.IIAPI_TS_TYPE,    /* Ingres Timestamp */
-		C.IIAPI_TSWO_TYPE,  /* Timestamp without Timezone */
-		C.IIAPI_TSTZ_TYPE,  /* Timestamp with Timezone */
-		C.IIAPI_INTYM_TYPE, /* Interval Year to Month */
-		C.IIAPI_INTDS_TYPE: /* Interval Day to Second */
-		var err error
+	case C.IIAPI_DTE_TYPE: /* Ingres Date */
+		t, ok, err := decodeIngresDate(val)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return t, nil
+		}
 
-		res, err = convertToStr(col, val)
+		// ingresdate intervals have no time.Time form
+		str, err := convertToStr(col, val)
+		if err != nil {
+			return nil, err
+		}
+		res = shrinkStrWithBlanks(str)
+	case C.IIAPI_DATE_TYPE: /* ANSI Date */
+		return decodeAnsiDate(val)
+	case C.IIAPI_TMWO_TYPE: /* Time without Timezone */
+		return decodeTime(val, zoneNone)
+	case C.IIAPI_TMTZ_TYPE: /* Time with Timezone */
+		return decodeTime(val, zoneFixed)
+	case C.IIAPI_TIME_TYPE: /* Ingres Time */
+		return decodeTime(val, zoneLocal)
+	case C.IIAPI_TSWO_TYPE: /* Timestamp without Timezone */
+		return decodeTimestamp(val, zoneNone)
+	case C.IIAPI_TSTZ_TYPE: /* Timestamp with Timezone */
+		return decodeTimestamp(val, zoneFixed)
+	case C.IIAPI_TS_TYPE: /* Ingres Timestamp */
+		return decodeTimestamp(val, zoneLocal)
+	case C.IIAPI_INTYM_TYPE: /* Interval Year to Month */
+		// strings are converted by database/sql, YearMonthInterval.Scan
+		// parses them back
+		ym, err := decodeIntervalYM(val)
+		if err != nil {
+			return nil, err
+		}
+		res = ym.String()
+	case C.IIAPI_INTDS_TYPE: /* Interval Day to Second */
+		return decodeIntervalDS(val)
+	case C.IIAPI_DEC_TYPE: /* Decimal */
+		d, err := decodePacked(val, int(col.precision), int(col.scale))
+		if err != nil {
+			return nil, err
+		}
+		res = d.String()
+	case C.IIAPI_MNY_TYPE: /* Money */
+		d, err := decodeMoney(val)
 		if err != nil {
 			return nil, err
 		}
-		res = shrinkStrWithBlanks(res.(string))
+		res = d.String()
+	case C.IIAPI_UUID_TYPE:
+		if len(val) != 16 {
+			return nil, errors.New("unexpected UUID value length")
+		}
+		// UUID and IPAddr scan the string forms
+		res = UUID(val).String()
+	case C.IIAPI_IPV4_TYPE:
+		if len(val) < 4 {
+			return nil, errors.New("unexpected IPv4 value length")
+		}
+		res = netip.AddrFrom4([4]byte(val)).String()
+	case C.IIAPI_IPV6_TYPE:
+		if len(val) < 16 {
+			return nil, errors.New("unexpected IPv6 value length")
+		}
+		res = netip.AddrFrom16([16]byte(val)).String()
 	default:
 		return nil, errors.New("type is not supported")
 	}
@@ -1547,12 +2260,24 @@ func convertToStr(cd *columnDesc, val []byte) (string, error) {
 }
 
 func (rs *rows) Next(dest []driver.Value) (err error) {
-	err = rs.fetchData()
+	if err = rs.stmt.conn.acquireRows("next", rs); err != nil {
+		return err
+	}
+	defer rs.stmt.conn.release()
+
+	return rs.nextContext(context.Background(), dest)
+}
+
+func (rs *rows) nextContext(ctx context.Context, dest []driver.Value) (err error) {
+	err = rs.fetchDataContext(ctx)
 	if err != nil {
 		return err
 	}
 
 	if rs.done {
+		if err = rs.assignProcOutputs(); err != nil {
+			return err
+		}
 		return io.EOF
 	}
 
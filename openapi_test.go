@@ -1,16 +1,21 @@
 package ingres
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"database/sql/driver"
 	"errors"
 	"fmt"
 	"io"
+	"net/netip"
 	"os"
+	"reflect"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -205,6 +210,44 @@ func TestCommitWithActiveRowsReturnsStateError(t *testing.T) {
 	require.NoError(t, tx.Commit())
 }
 
+func TestConnStateMisuse(t *testing.T) {
+	conn, deinit := testconn(t)
+	defer deinit()
+
+	tx, err := conn.Begin()
+	require.NoError(t, err)
+	assert.Equal(t, ConnInTx, conn.State())
+
+	_, err = conn.Begin()
+	require.ErrorIs(t, err, ErrTxInProgress)
+
+	rows, err := conn.Query("select reltid from iirelation", nil)
+	require.NoError(t, err)
+	assert.Equal(t, ConnInQuery, conn.State())
+
+	_, err = conn.Exec("delete from iirelation where 1 = 0", nil)
+	require.ErrorIs(t, err, ErrConnBusy)
+
+	var stateErr *StateError
+	require.True(t, errors.As(err, &stateErr))
+	assert.Equal(t, "exec", stateErr.Op)
+
+	require.NoError(t, rows.Close())
+	assert.Equal(t, ConnInTx, conn.State())
+
+	require.NoError(t, tx.Commit())
+	assert.Equal(t, ConnIdle, conn.State())
+	require.ErrorIs(t, tx.Commit(), ErrTxDone)
+	require.ErrorIs(t, tx.Rollback(), ErrTxDone)
+
+	require.NoError(t, conn.Close())
+	assert.Equal(t, ConnBroken, conn.State())
+
+	_, err = conn.Query("select reltid from iirelation", nil)
+	require.ErrorIs(t, err, ErrConnBroken)
+	require.ErrorIs(t, err, driver.ErrBadConn)
+}
+
 func TestTxEarlyCloseLoop(t *testing.T) {
 	db, err := sql.Open("ingres", testDBName)
 	require.NoError(t, err)
@@ -599,16 +642,18 @@ func TestDates(t *testing.T) {
 	err = rows.Next(dest)
 	require.NoError(t, err)
 
-	assert.Equal(t, dest[0].(string), "10-oct-2021")
-	assert.Equal(t, dest[1].(string), "2022-10-10")
-	assert.Equal(t, dest[2].(string), "12:30:55-05:00")
-	assert.Equal(t, dest[3].(string), "12:30:55")
-	assert.Equal(t, dest[4].(string), "12:30:56")
-	assert.Equal(t, dest[5].(string), "2006-12-15 09:30:55-08:00")
-	assert.Equal(t, dest[6].(string), "2007-12-15 12:30:55")
-	assert.Equal(t, dest[7].(string), "2008-12-15 12:30:55")
-	assert.Equal(t, dest[8].(string), "55-04")
-	assert.Equal(t, dest[9].(string), "-18 12:02:23")
+	assert.Equal(t, time.Date(2021, 10, 10, 0, 0, 0, 0, time.UTC), dest[0].(time.Time))
+	assert.Equal(t, time.Date(2022, 10, 10, 0, 0, 0, 0, time.UTC), dest[1].(time.Time))
+	assert.Equal(t, "12:30:55-05:00", dest[2].(time.Time).Format("15:04:05-07:00"))
+	assert.Equal(t, "12:30:55", dest[3].(time.Time).Format("15:04:05"))
+	assert.Equal(t, time.UTC, dest[3].(time.Time).Location())
+	assert.Equal(t, "12:30:56", dest[4].(time.Time).Format("15:04:05"))
+	assert.Equal(t, "2006-12-15 09:30:55-08:00", dest[5].(time.Time).Format("2006-01-02 15:04:05-07:00"))
+	assert.Equal(t, time.Date(2007, 12, 15, 12, 30, 55, 0, time.UTC), dest[6].(time.Time))
+	assert.True(t, time.Date(2008, 12, 15, 12, 30, 55, 0, time.Local).Equal(dest[7].(time.Time)))
+	assert.Equal(t, time.Local, dest[7].(time.Time).Location())
+	assert.Equal(t, "55-04", dest[8])
+	assert.Equal(t, -(18*24*time.Hour + 12*time.Hour + 2*time.Minute + 23*time.Second), dest[9].(time.Duration))
 }
 
 func TestNull(t *testing.T) {
@@ -806,3 +851,1245 @@ func TestInsert5000Rows(t *testing.T) {
 	_, err = conn.Exec("drop table test_5000_rows")
 	require.NoError(t, err)
 }
+
+func TestCopyIn(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_copy_in")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_copy_in (id int not null, name varchar(100), price decimal(10, 2), " +
+		"created ansidate, note long varchar)")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	cw, err := CopyIn(ctx, conn, "test_copy_in", []string{"name", "id", "price", "created", "note"})
+	require.NoError(t, err)
+
+	created := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5000; i++ {
+		var name any
+		if i%10 != 0 {
+			name = fmt.Sprintf("name_%d", i)
+		}
+		err = cw.WriteRow(ctx, name, i, "12.50", created, strings.Repeat("n", i%50))
+		require.NoError(t, err)
+	}
+	assert.Equal(t, int64(5000), cw.Count())
+	require.NoError(t, cw.Close(ctx))
+
+	var count, nulls int
+	var sum float64
+	err = conn.QueryRowContext(ctx, "select count(*), count(*) - count(name), sum(price) from test_copy_in").
+		Scan(&count, &nulls, &sum)
+	require.NoError(t, err)
+	assert.Equal(t, 5000, count)
+	assert.Equal(t, 500, nulls)
+	assert.Equal(t, 12.5*5000, sum)
+
+	var name, note string
+	err = conn.QueryRowContext(ctx, "select name, note from test_copy_in where id = 42").Scan(&name, &note)
+	require.NoError(t, err)
+	assert.Equal(t, "name_42", name)
+	assert.Equal(t, strings.Repeat("n", 42), note)
+
+	// not nullable column should be loaded
+	_, err = CopyIn(ctx, conn, "test_copy_in", []string{"name"})
+	assert.Error(t, err)
+
+	// aborted copy loads nothing
+	cw, err = CopyIn(ctx, conn, "test_copy_in", []string{"id"})
+	require.NoError(t, err)
+	require.NoError(t, cw.WriteRow(ctx, 1))
+	assert.Error(t, cw.WriteRow(ctx, 1, 2))
+	require.NoError(t, cw.Abort(ctx))
+
+	err = conn.QueryRowContext(ctx, "select count(*) from test_copy_in").Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 5000, count)
+
+	_, err = conn.ExecContext(ctx, "drop table test_copy_in")
+	require.NoError(t, err)
+}
+
+func TestCopyOut(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_copy_out")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_copy_out (id int, name varchar(100), note long varchar)")
+	require.NoError(t, err)
+
+	for i := 0; i < 100; i++ {
+		var name any
+		if i%10 != 0 {
+			name = fmt.Sprintf("name_%d", i)
+		}
+		_, err = db.Exec("insert into test_copy_out values (?, ?, ?)", i, name, strings.Repeat("n", i))
+		require.NoError(t, err)
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	seen := make(map[int64]bool)
+	count, err := CopyOut(ctx, conn, "test_copy_out", []string{"note", "id", "name"}, func(row []driver.Value) error {
+		require.Len(t, row, 3)
+
+		id := row[1].(int64)
+		seen[id] = true
+		assert.Equal(t, strings.Repeat("n", int(id)), row[0])
+
+		if id%10 == 0 {
+			assert.Nil(t, row[2])
+		} else {
+			assert.Equal(t, fmt.Sprintf("name_%d", id), row[2])
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), count)
+	assert.Len(t, seen, 100)
+
+	// the error of the callback stops the export
+	stop := errors.New("stop")
+	count, err = CopyOut(ctx, conn, "test_copy_out", nil, func(row []driver.Value) error {
+		require.Len(t, row, 3)
+		return stop
+	})
+	assert.ErrorIs(t, err, stop)
+	assert.Equal(t, int64(0), count)
+
+	// the connection is usable after the cancelled export
+	var total int
+	require.NoError(t, conn.QueryRowContext(ctx, "select count(*) from test_copy_out").Scan(&total))
+	assert.Equal(t, 100, total)
+
+	_, err = conn.ExecContext(ctx, "drop table test_copy_out")
+	require.NoError(t, err)
+}
+
+func TestBatch(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_batch")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_batch (id int not null primary key, name varchar(100))")
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	check := func(results []BatchResult, expected ...int64) {
+		t.Helper()
+		require.Len(t, results, len(expected))
+		for i, res := range results {
+			require.NoError(t, res.Err)
+			assert.Equal(t, expected[i], res.RowsAffected)
+		}
+	}
+
+	// autocommit
+	b := NewBatch(conn)
+	for i := 0; i < 100; i++ {
+		var name any
+		if i%10 != 0 {
+			name = fmt.Sprintf("name_%d", i)
+		}
+		b.Queue("insert into test_batch values (?, ?)", i, name)
+	}
+	b.Queue("update test_batch set name = :name where id < :id", sql.Named("id", 5), sql.Named("name", "first"))
+	assert.Equal(t, 101, b.Len())
+
+	results, err := b.Send(ctx)
+	require.NoError(t, err)
+	require.Len(t, results, 101)
+	check(results[100:], 5)
+	assert.Equal(t, 0, b.Len())
+
+	// explicit transaction
+	tx, err := conn.BeginTx(ctx, nil)
+	require.NoError(t, err)
+
+	b = NewBatch(conn)
+	b.Queue("update test_batch set name = ? where id = ?", "a", 1)
+	b.Queue("update test_batch set name = ? where id = ?", "abc", 2)
+	b.Queue("update test_batch set name = ? where id = ?", nil, 1000)
+	b.Queue("delete from test_batch where id >= ?", 50)
+
+	results, err = b.Send(ctx)
+	require.NoError(t, err)
+	check(results, 1, 1, 0, 50)
+	require.NoError(t, tx.Commit())
+
+	var count int
+	var name string
+	require.NoError(t, conn.QueryRowContext(ctx, "select count(*) from test_batch").Scan(&count))
+	assert.Equal(t, 50, count)
+	require.NoError(t, conn.QueryRowContext(ctx, "select name from test_batch where id = 2").Scan(&name))
+	assert.Equal(t, "abc", name)
+
+	// failed statement doesn't stop the batch
+	b = NewBatch(conn)
+	b.Queue("insert into test_batch values (?, ?)", 1, "duplicate")
+	b.Queue("insert into test_batch values (?, ?)", 1000, "new")
+
+	results, err = b.Send(ctx)
+	assert.Error(t, err)
+	require.Len(t, results, 2)
+	assert.Error(t, results[0].Err)
+	require.NoError(t, results[1].Err)
+	assert.Equal(t, int64(1), results[1].RowsAffected)
+
+	_, err = conn.ExecContext(ctx, "drop table test_batch")
+	require.NoError(t, err)
+}
+
+func TestIntervalArgs(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_intervals")
+	require.NoError(t, err)
+
+	_, err = db.Exec(`create table test_intervals(
+        ym interval year to month,
+        ds interval day to second(6)
+    )`)
+	require.NoError(t, err)
+
+	sla := 3*24*time.Hour + 4*time.Hour + 30*time.Second + 250*time.Microsecond
+	_, err = db.Exec("insert into test_intervals values (?, ?)",
+		YearMonthInterval{Years: -1, Months: -2}, sla)
+	require.NoError(t, err)
+
+	var ym YearMonthInterval
+	var ds time.Duration
+	err = db.QueryRow("select ym, ds from test_intervals").Scan(&ym, &ds)
+	require.NoError(t, err)
+	assert.Equal(t, -14, ym.TotalMonths())
+	assert.Equal(t, sla, ds)
+
+	var str string
+	err = db.QueryRow("select ym from test_intervals").Scan(&str)
+	require.NoError(t, err)
+	assert.Equal(t, "-1-02", str)
+
+	_, err = db.Exec("drop table test_intervals")
+	require.NoError(t, err)
+}
+
+func TestDecimal(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_decimal")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_decimal(d decimal(20, 4), m money)")
+	require.NoError(t, err)
+
+	price, err := ParseDecimal("1234567890123.4560")
+	require.NoError(t, err)
+
+	_, err = db.Exec("insert into test_decimal values (?, 12.34)", price)
+	require.NoError(t, err)
+
+	var d, m Decimal
+	err = db.QueryRow("select d, m from test_decimal").Scan(&d, &m)
+	require.NoError(t, err)
+	assert.Equal(t, "1234567890123.4560", d.String())
+	assert.Equal(t, 4, d.Scale())
+	assert.Equal(t, "12.34", m.String())
+
+	rows, err := db.Query("select d from test_decimal")
+	require.NoError(t, err)
+	types, err := rows.ColumnTypes()
+	require.NoError(t, err)
+	precision, scale, ok := types[0].DecimalSize()
+	assert.True(t, ok)
+	assert.Equal(t, int64(20), precision)
+	assert.Equal(t, int64(4), scale)
+	require.NoError(t, rows.Close())
+
+	var str string
+	err = db.QueryRow("select d from test_decimal").Scan(&str)
+	require.NoError(t, err)
+	assert.Equal(t, "1234567890123.4560", str)
+
+	_, err = db.Exec("drop table test_decimal")
+	require.NoError(t, err)
+}
+
+func TestUUIDAndIP(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_audit")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_audit(id uuid, v4 ipv4, v6 ipv6)")
+	require.NoError(t, err)
+
+	id, err := ParseUUID("0f8fad5b-d9cb-469f-a165-70867728950e")
+	require.NoError(t, err)
+	v4 := netip.MustParseAddr("192.168.1.10")
+	v6 := netip.MustParseAddr("2001:db8::1")
+
+	_, err = db.Exec("insert into test_audit values (?, ?, ?)", id, v4, v6)
+	require.NoError(t, err)
+
+	var resID UUID
+	var res4, res6 IPAddr
+	err = db.QueryRow("select id, v4, v6 from test_audit").Scan(&resID, &res4, &res6)
+	require.NoError(t, err)
+	assert.Equal(t, id, resID)
+	assert.Equal(t, v4, res4.Addr)
+	assert.Equal(t, v6, res6.Addr)
+
+	var strID, str4 string
+	err = db.QueryRow("select id, v4 from test_audit").Scan(&strID, &str4)
+	require.NoError(t, err)
+	assert.Equal(t, "0f8fad5b-d9cb-469f-a165-70867728950e", strID)
+	assert.Equal(t, "192.168.1.10", str4)
+
+	_, err = db.Exec("insert into test_audit values (?, ?, ?)", id, res4, res6)
+	require.NoError(t, err)
+
+	_, err = db.Exec("drop table test_audit")
+	require.NoError(t, err)
+}
+
+func TestNativeArgs(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_native_args")
+	require.NoError(t, err)
+
+	_, err = db.Exec(`create table test_native_args(
+        ts timestamp with time zone,
+        b varbyte(20),
+        f boolean,
+        u bigint,
+        n varchar(10)
+    )`)
+	require.NoError(t, err)
+
+	now := time.Date(2023, 5, 1, 10, 20, 30, 0, time.FixedZone("", 3*3600))
+	_, err = db.Exec("insert into test_native_args values (?, ?, ?, ?, ?)",
+		now, []byte{1, 2, 3}, true, uint32(4000000000), nil)
+	require.NoError(t, err)
+
+	var ts time.Time
+	var b []byte
+	var f bool
+	var u uint64
+	var n sql.NullString
+	err = db.QueryRow("select * from test_native_args").Scan(&ts, &b, &f, &u, &n)
+	require.NoError(t, err)
+	assert.True(t, now.Equal(ts))
+	assert.Equal(t, []byte{1, 2, 3}, b)
+	assert.True(t, f)
+	assert.Equal(t, uint64(4000000000), u)
+	assert.False(t, n.Valid)
+
+	_, err = db.Exec("insert into test_native_args (u) values (?)", uint64(1<<63))
+	assert.Error(t, err)
+
+	_, err = db.Exec("drop table test_native_args")
+	require.NoError(t, err)
+}
+
+func TestLongArgs(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_long_args")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_long_args(a int, b long varchar, c long byte, d int)")
+	require.NoError(t, err)
+
+	doc := strings.Repeat("document ", 20000)
+	blob := bytes.Repeat([]byte{0, 1, 2, 3}, 30000)
+
+	_, err = db.Exec("insert into test_long_args values (?, ?, ?, ?)", 1, doc, blob, 2)
+	require.NoError(t, err)
+
+	var a, d int
+	var b string
+	var c []byte
+	err = db.QueryRow("select * from test_long_args").Scan(&a, &b, &c, &d)
+	require.NoError(t, err)
+	assert.Equal(t, 1, a)
+	assert.Equal(t, doc, b)
+	assert.Equal(t, blob, c)
+	assert.Equal(t, 2, d)
+
+	_, err = db.Exec("drop table test_long_args")
+	require.NoError(t, err)
+}
+
+func TestStreamLOB(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName+"?lobstream=true")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_stream_lob")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_stream_lob(a int, b long byte)")
+	require.NoError(t, err)
+
+	_, err = db.Exec("insert into test_stream_lob values (1, repeat('a', 100000)), (2, repeat('b', 12345)), (3, null)")
+	require.NoError(t, err)
+
+	rows, err := db.Query("select a, b from test_stream_lob order by a")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	types, err := rows.ColumnTypes()
+	require.NoError(t, err)
+	assert.Equal(t, reflect.TypeOf((*LOBReader)(nil)), types[1].ScanType())
+
+	// first value is read fully
+	var a int
+	var r io.Reader
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Scan(&a, &r))
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("a"), 100000), data)
+
+	// second one by parts, the reader is valid until the next row
+	var lob LOBReader
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Scan(&a, &lob))
+	buf := make([]byte, 10)
+	_, err = io.ReadFull(&lob, buf)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("bbbbbbbbbb"), buf)
+
+	data, err = io.ReadAll(&lob)
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("b"), 12345-10), data)
+
+	prev := lob
+
+	// NULL gives an empty reader
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Scan(&a, &lob))
+	assert.Equal(t, 3, a)
+	_, err = lob.Read(buf)
+	assert.ErrorIs(t, err, io.EOF)
+
+	_, err = prev.Read(buf)
+	assert.ErrorIs(t, err, errLOBClosed)
+
+	require.False(t, rows.Next())
+	require.NoError(t, rows.Err())
+
+	// unread part of the value is skipped by Next
+	rows, err = db.Query("select a, b from test_stream_lob order by a")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Scan(&a, &lob))
+	_, err = io.ReadFull(&lob, buf)
+	require.NoError(t, err)
+	assert.Equal(t, []byte("aaaaaaaaaa"), buf)
+	prev = lob
+
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Scan(&a, &lob))
+	assert.Equal(t, 2, a)
+	data, err = io.ReadAll(&lob)
+	require.NoError(t, err)
+	assert.Equal(t, bytes.Repeat([]byte("b"), 12345), data)
+
+	_, err = prev.Read(buf)
+	assert.ErrorIs(t, err, errLOBClosed)
+	require.NoError(t, rows.Close())
+
+	_, err = db.Exec("drop table test_stream_lob")
+	require.NoError(t, err)
+}
+
+func TestParseConnParams(t *testing.T) {
+	params, err := parseConnParams("vnode::db?username=actian&password=pass&lobstream=true&nvarchar=1")
+	require.NoError(t, err)
+	assert.Equal(t, "vnode::db", params.DbName)
+	assert.Equal(t, "actian", params.UserName)
+	assert.True(t, params.StreamLOBs)
+	assert.True(t, params.NVarchar)
+
+	_, err = parseConnParams("db?lobstream=maybe")
+	assert.Error(t, err)
+
+	params, err = parseConnParams("db?placeholders=dollar")
+	require.NoError(t, err)
+	assert.True(t, params.DollarPlaceholders)
+
+	_, err = parseConnParams("db?placeholders=colon")
+	assert.Error(t, err)
+
+	params, err = parseConnParams("db?repeat=true")
+	require.NoError(t, err)
+	assert.True(t, params.RepeatQueries)
+
+	params, err = parseConnParams("db?multistatements=true")
+	require.NoError(t, err)
+	assert.True(t, params.MultiStatements)
+
+	_, err = parseConnParams("db?multistatements=maybe")
+	assert.Error(t, err)
+
+	params, err = parseConnParams("db?fetchrows=500")
+	require.NoError(t, err)
+	assert.Equal(t, 500, params.FetchRows)
+
+	_, err = parseConnParams("db?fetchrows=0")
+	assert.Error(t, err)
+}
+
+func TestBindArgs(t *testing.T) {
+	c := &OpenAPIConn{params: ConnParams{DollarPlaceholders: true}}
+
+	query, vals, err := c.bindArgs("select $2, $1, $2", namedValues([]driver.Value{1, "a"}))
+	require.NoError(t, err)
+	assert.Equal(t, "select ?, ?, ?", query)
+	assert.Equal(t, []driver.Value{"a", 1, "a"}, vals)
+
+	// translated text is passed as it is
+	query, vals, err = c.bindArgs(query, namedValues(vals))
+	require.NoError(t, err)
+	assert.Equal(t, "select ?, ?, ?", query)
+	assert.Equal(t, []driver.Value{"a", 1, "a"}, vals)
+
+	c.params.DollarPlaceholders = false
+	query, _, err = c.bindArgs("select $1", namedValues([]driver.Value{1}))
+	require.NoError(t, err)
+	assert.Equal(t, "select $1", query)
+}
+
+func TestBeginStatement(t *testing.T) {
+	query, err := beginStatement(driver.TxOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "begin transaction", query)
+
+	query, err = beginStatement(driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelReadCommitted)})
+	require.NoError(t, err)
+	assert.Equal(t, "set transaction isolation level read committed", query)
+
+	query, err = beginStatement(driver.TxOptions{
+		Isolation: driver.IsolationLevel(sql.LevelSerializable),
+		ReadOnly:  true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "set transaction isolation level serializable, read only", query)
+
+	query, err = beginStatement(driver.TxOptions{ReadOnly: true})
+	require.NoError(t, err)
+	assert.Equal(t, "set transaction read only", query)
+
+	_, err = beginStatement(driver.TxOptions{Isolation: driver.IsolationLevel(sql.LevelSnapshot)})
+	assert.EqualError(t, err, "isolation level Snapshot is not supported")
+}
+
+func TestBeginTxOptions(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted, ReadOnly: true})
+	require.NoError(t, err)
+
+	var reltid int32
+	err = tx.QueryRow("select reltid from iirelation").Scan(&reltid)
+	require.NoError(t, err)
+
+	_, err = tx.Exec("create table test_readonly_tx(a int)")
+	assert.Error(t, err)
+	require.NoError(t, tx.Rollback())
+
+	_, err = db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelLinearizable})
+	assert.EqualError(t, err, "isolation level Linearizable is not supported")
+}
+
+func TestStreamLOBArgs(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_stream_args")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_stream_args(a int, b long byte, c long varchar)")
+	require.NoError(t, err)
+
+	blob := bytes.Repeat([]byte{1, 2, 3, 4, 5}, 50000)
+	text := strings.Repeat("upload ", 3000)
+
+	_, err = db.Exec("insert into test_stream_args values (?, ?, ?)", 1,
+		bytes.NewReader(blob), LOBStream{Reader: strings.NewReader(text), Text: true})
+	require.NoError(t, err)
+
+	_, err = db.Exec("insert into test_stream_args values (?, ?, ?)", 2,
+		bytes.NewReader(nil), LOBStream{Reader: strings.NewReader(""), Text: true})
+	require.NoError(t, err)
+
+	var b []byte
+	var c string
+	err = db.QueryRow("select b, c from test_stream_args where a = 1").Scan(&b, &c)
+	require.NoError(t, err)
+	assert.Equal(t, blob, b)
+	assert.Equal(t, text, c)
+
+	err = db.QueryRow("select b, c from test_stream_args where a = 2").Scan(&b, &c)
+	require.NoError(t, err)
+	assert.Empty(t, b)
+	assert.Empty(t, c)
+
+	_, err = db.Exec("drop table test_stream_args")
+	require.NoError(t, err)
+}
+
+func TestNString(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_nstring")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_nstring(a int, name nvarchar(50), bio long nvarchar)")
+	require.NoError(t, err)
+
+	name := "Zoë Ωmega 山田 🙂"
+	bio := strings.Repeat("Пример текста 🙂 ", 2000)
+
+	_, err = db.Exec("insert into test_nstring values (?, ?, ?)", 1, NString(name), NString(bio))
+	require.NoError(t, err)
+
+	var resName, resBio string
+	err = db.QueryRow("select name, bio from test_nstring where a = 1").Scan(&resName, &resBio)
+	require.NoError(t, err)
+	assert.Equal(t, name, resName)
+	assert.Equal(t, bio, resBio)
+
+	// all strings as nvarchar
+	udb, err := sql.Open("ingres", testDBName+"?nvarchar=true")
+	require.NoError(t, err)
+	defer udb.Close()
+
+	_, err = udb.Exec("insert into test_nstring (a, name) values (?, ?)", 2, name)
+	require.NoError(t, err)
+
+	err = udb.QueryRow("select name from test_nstring where a = 2").Scan(&resName)
+	require.NoError(t, err)
+	assert.Equal(t, name, resName)
+
+	_, err = db.Exec("drop table test_nstring")
+	require.NoError(t, err)
+}
+
+func TestNamedArgs(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_named")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_named(id int, name varchar(20))")
+	require.NoError(t, err)
+
+	_, err = db.Exec("insert into test_named values (:id, :name)",
+		sql.Named("name", "it's :id"), sql.Named("id", 7))
+	require.NoError(t, err)
+
+	var name string
+	err = db.QueryRow("select name from test_named where id = @id and id >= :id",
+		sql.Named("id", 7)).Scan(&name)
+	require.NoError(t, err)
+	assert.Equal(t, "it's :id", name)
+
+	_, err = db.Exec("drop table test_named")
+	require.NoError(t, err)
+}
+
+func TestDollarPlaceholders(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName+"?placeholders=dollar")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_dollar")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_dollar(id int, name varchar(20), parent int)")
+	require.NoError(t, err)
+
+	_, err = db.Exec("insert into test_dollar values ($2, $1, $2)", "costs $1", 3)
+	require.NoError(t, err)
+
+	var name string
+	var parent int
+	err = db.QueryRow("select name, parent from test_dollar where id = $1 and parent = $1", 3).Scan(&name, &parent)
+	require.NoError(t, err)
+	assert.Equal(t, "costs $1", name)
+	assert.Equal(t, 3, parent)
+
+	// usual markers still work
+	err = db.QueryRow("select name from test_dollar where id = ?", 3).Scan(&name)
+	require.NoError(t, err)
+
+	_, err = db.Exec("drop table test_dollar")
+	require.NoError(t, err)
+}
+
+func TestPreparedStmt(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_prepared")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_prepared (id int, name varchar(100))")
+	require.NoError(t, err)
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+
+	ins, err := tx.Prepare("insert into test_prepared values (?, ?)")
+	require.NoError(t, err)
+
+	for i := 0; i < 5000; i++ {
+		_, err = ins.Exec(i, fmt.Sprintf("name_%d", i))
+		require.NoError(t, err)
+	}
+
+	// the number of parameters is known after preparation
+	_, err = ins.Exec(1)
+	assert.Error(t, err)
+
+	require.NoError(t, ins.Close())
+
+	sel, err := tx.Prepare("select name from test_prepared where id = ?")
+	require.NoError(t, err)
+
+	for _, id := range []int{1, 4999} {
+		var name string
+		err = sel.QueryRow(id).Scan(&name)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("name_%d", id), name)
+	}
+	require.NoError(t, sel.Close())
+
+	// ~V values are parameters of the prepared statement
+	tilde, err := tx.Prepare("select name from test_prepared where id = ~V and name <> '~V'")
+	require.NoError(t, err)
+	require.NotNil(t, tilde)
+
+	var name string
+	require.NoError(t, tilde.QueryRow(2).Scan(&name))
+	assert.Equal(t, "name_2", name)
+	require.NoError(t, tilde.Close())
+
+	// errors are returned by Prepare
+	_, err = tx.Prepare("select from nowhere")
+	assert.Error(t, err)
+
+	// statements which can't be prepared are sent as text
+	commit, err := tx.Prepare("commit")
+	require.NoError(t, err)
+	require.NoError(t, commit.Close())
+
+	require.NoError(t, tx.Rollback())
+
+	// outside of transactions statements are prepared too, and prepared
+	// again after the server discards them
+	_, err = db.Exec("insert into test_prepared values (?, ?)", 1, "one")
+	require.NoError(t, err)
+
+	conn, err := db.Conn(context.Background())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	stmt, err := conn.PrepareContext(context.Background(), "select count(*) from test_prepared where id = ?")
+	require.NoError(t, err)
+	defer stmt.Close()
+
+	_, err = stmt.Query()
+	assert.Error(t, err, "the number of parameters is known")
+
+	for i := 0; i < 3; i++ {
+		var cnt int
+		require.NoError(t, stmt.QueryRow(1).Scan(&cnt))
+		assert.Equal(t, 1, cnt)
+
+		tx, err := conn.BeginTx(context.Background(), nil)
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit())
+	}
+
+	_, err = db.Exec("drop table test_prepared")
+	require.NoError(t, err)
+}
+
+func TestRepeatQueries(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName+"?repeat=true")
+	require.NoError(t, err)
+	defer db.Close()
+
+	createTable := func() {
+		_, err = db.Exec("drop table if exists test_repeat")
+		require.NoError(t, err)
+
+		_, err = db.Exec("create table test_repeat (id int, name varchar(100))")
+		require.NoError(t, err)
+	}
+	createTable()
+
+	for i := 0; i < 100; i++ {
+		res, err := db.Exec("insert into test_repeat values (?, ?)", i, fmt.Sprintf("name_%d", i))
+		require.NoError(t, err)
+
+		cnt, err := res.RowsAffected()
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), cnt)
+	}
+
+	check := func(id int, expected string) {
+		var name string
+		err := db.QueryRow("select name from test_repeat where id = ?", id).Scan(&name)
+		require.NoError(t, err)
+		assert.Equal(t, expected, name)
+	}
+
+	for i := 0; i < 100; i += 10 {
+		check(i, fmt.Sprintf("name_%d", i))
+	}
+
+	// the server forgets repeat queries of dropped tables, they should
+	// be defined again
+	createTable()
+
+	_, err = db.Exec("insert into test_repeat values (?, ?)", 1, "again")
+	require.NoError(t, err)
+	check(1, "again")
+
+	_, err = db.Exec("drop table test_repeat")
+	require.NoError(t, err)
+}
+
+func TestProcedure(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop procedure if exists test_proc_calc")
+	require.NoError(t, err)
+
+	_, err = db.Exec(`create procedure test_proc_calc(a integer not null,
+		b integer not null, total integer, note varchar(20)) as
+		begin
+			total = a + b;
+			note = note + '!';
+			return a * b;
+		end`)
+	require.NoError(t, err)
+
+	var total int
+	var ret int64
+	note := "sum"
+
+	_, err = db.Exec("{? = call test_proc_calc(?, ?, ?, ?)}", sql.Out{Dest: &ret}, 3, 4,
+		sql.Out{Dest: &total}, sql.Out{Dest: &note, In: true})
+	require.NoError(t, err)
+	assert.Equal(t, int64(12), ret)
+	assert.Equal(t, 7, total)
+	assert.Equal(t, "sum!", note)
+
+	// named arguments are passed as they are
+	total = 0
+	_, err = db.Exec("{call test_proc_calc}", sql.Named("b", 5), sql.Named("a", 1),
+		sql.Named("total", sql.Out{Dest: &total}))
+	require.NoError(t, err)
+	assert.Equal(t, 6, total)
+
+	_, err = db.Exec("{call test_proc_calc(?)}", 1, 2)
+	assert.Error(t, err)
+
+	_, err = db.Exec("drop procedure test_proc_calc")
+	require.NoError(t, err)
+}
+
+func TestRowProducingProcedure(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop procedure if exists test_proc_rows")
+	require.NoError(t, err)
+
+	_, err = db.Exec(`create procedure test_proc_rows(n integer not null)
+		result row (integer, varchar(20)) as
+		declare
+			i integer not null;
+		begin
+			i = 1;
+			while i <= n do
+				return row (i, 'row ' + varchar(i));
+				i = i + 1;
+			endwhile;
+			return n * 10;
+		end`)
+	require.NoError(t, err)
+
+	var ret int64
+	rows, err := db.Query("{? = call test_proc_rows(?)}", sql.Out{Dest: &ret}, 3)
+	require.NoError(t, err)
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		var name string
+		require.NoError(t, rows.Scan(&id, &name))
+		assert.Equal(t, fmt.Sprintf("row %d", id), name)
+		ids = append(ids, id)
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, []int{1, 2, 3}, ids)
+	assert.Equal(t, int64(30), ret)
+
+	// closing without reading all rows
+	ret = 0
+	rows, err = db.Query("{? = call test_proc_rows(?)}", sql.Out{Dest: &ret}, 5)
+	require.NoError(t, err)
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Close())
+	assert.Equal(t, int64(50), ret)
+
+	_, err = db.Exec("drop procedure test_proc_rows")
+	require.NoError(t, err)
+}
+
+func TestNextResultSet(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName+"?multistatements=true")
+	require.NoError(t, err)
+	defer db.Close()
+
+	rows, err := db.Query(`select 1 as a, 'x;y' as b; select ? as c;
+		select ? as d union all select ? as d`, 2, "z", "w")
+	require.NoError(t, err)
+	defer rows.Close()
+
+	var a, c int
+	var b string
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Scan(&a, &b))
+	assert.Equal(t, 1, a)
+	assert.Equal(t, "x;y", b)
+	assert.False(t, rows.Next())
+
+	require.True(t, rows.NextResultSet())
+	cols, err := rows.Columns()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"c"}, cols)
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Scan(&c))
+	assert.Equal(t, 2, c)
+
+	// unread rows are skipped
+	require.True(t, rows.NextResultSet())
+	var ds []string
+	for rows.Next() {
+		var d string
+		require.NoError(t, rows.Scan(&d))
+		ds = append(ds, d)
+	}
+	assert.ElementsMatch(t, []string{"z", "w"}, ds)
+
+	assert.False(t, rows.NextResultSet())
+	require.NoError(t, rows.Err())
+
+	_, err = db.Query("select ?; select ?", 1)
+	assert.Error(t, err)
+
+	// errors of later statements are returned by Err
+	rows, err = db.Query("select 1 as a; select * from no_such_table; select 2 as b")
+	require.NoError(t, err)
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Scan(&a))
+	assert.Equal(t, 1, a)
+	assert.False(t, rows.Next())
+
+	assert.False(t, rows.NextResultSet())
+	assert.Error(t, rows.Err())
+	require.NoError(t, rows.Close())
+
+	// the connection is usable after that
+	require.NoError(t, db.QueryRow("select 3").Scan(&a))
+	assert.Equal(t, 3, a)
+}
+
+func TestScrollableCursor(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_cursor")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_cursor (id int, name varchar(20))")
+	require.NoError(t, err)
+
+	for i := 1; i <= 10; i++ {
+		_, err = db.Exec("insert into test_cursor values (?, ?)", i, fmt.Sprintf("name_%d", i))
+		require.NoError(t, err)
+	}
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	cur, err := OpenCursor(ctx, conn, "select id, name from test_cursor where id > ? order by id",
+		CursorOptions{}, 0)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"id", "name"}, cur.Columns())
+
+	check := func(found bool, err error, expected int) {
+		t.Helper()
+		require.NoError(t, err)
+		require.True(t, found)
+
+		var id int
+		var name string
+		require.NoError(t, cur.Scan(&id, &name))
+		assert.Equal(t, expected, id)
+		assert.Equal(t, fmt.Sprintf("name_%d", expected), name)
+	}
+
+	found, err := cur.Last(ctx)
+	check(found, err, 10)
+
+	found, err = cur.Prior(ctx)
+	check(found, err, 9)
+
+	found, err = cur.First(ctx)
+	check(found, err, 1)
+
+	found, err = cur.Next(ctx)
+	check(found, err, 2)
+
+	found, err = cur.Absolute(ctx, 5)
+	check(found, err, 5)
+
+	found, err = cur.Relative(ctx, -2)
+	check(found, err, 3)
+
+	found, err = cur.Absolute(ctx, -1)
+	check(found, err, 10)
+
+	found, err = cur.Next(ctx)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	// the cursor is still usable after the end
+	found, err = cur.Prior(ctx)
+	check(found, err, 10)
+
+	require.NoError(t, cur.Close(ctx))
+
+	// forward only cursor
+	cur, err = OpenCursor(ctx, conn, "select id, name from test_cursor order by id",
+		CursorOptions{ForwardOnly: true})
+	require.NoError(t, err)
+
+	found, err = cur.Next(ctx)
+	check(found, err, 1)
+
+	_, err = cur.Prior(ctx)
+	assert.Error(t, err)
+	require.NoError(t, cur.Close(ctx))
+
+	_, err = conn.ExecContext(ctx, "drop table test_cursor")
+	require.NoError(t, err)
+}
+
+func TestUpdatableCursor(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName)
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_upd_cursor")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_upd_cursor (id int, price int)")
+	require.NoError(t, err)
+
+	for i := 1; i <= 5; i++ {
+		_, err = db.Exec("insert into test_upd_cursor values (?, ?)", i, i*10)
+		require.NoError(t, err)
+	}
+
+	tx, err := db.Begin()
+	require.NoError(t, err)
+
+	rows, err := tx.Query("declare c1 cursor for select id, price from test_upd_cursor for update of price")
+	require.NoError(t, err)
+
+	count := 0
+	for rows.Next() {
+		var id, price int
+		require.NoError(t, rows.Scan(&id, &price))
+		count++
+
+		if id%2 == 0 {
+			_, err = tx.Exec("delete from test_upd_cursor where current of c1")
+		} else {
+			_, err = tx.Exec("update test_upd_cursor set price = ? where current of c1", price+1)
+		}
+		require.NoError(t, err)
+	}
+	require.NoError(t, rows.Err())
+	require.NoError(t, rows.Close())
+	assert.Equal(t, 5, count)
+
+	// the cursor is closed with the rows
+	_, err = tx.Exec("delete from test_upd_cursor where current of c1")
+	assert.Error(t, err)
+	require.NoError(t, tx.Commit())
+
+	var total, sum int
+	require.NoError(t, db.QueryRow("select count(*), sum(price) from test_upd_cursor").Scan(&total, &sum))
+	assert.Equal(t, 3, total)
+	assert.Equal(t, 11+31+51, sum)
+
+	// cursor opened with OpenCursor
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	cur, err := OpenCursor(ctx, conn, "select id from test_upd_cursor for update of price",
+		CursorOptions{ForwardOnly: true, Name: "c2"})
+	require.NoError(t, err)
+
+	found, err := cur.Next(ctx)
+	require.NoError(t, err)
+	require.True(t, found)
+
+	res, err := conn.ExecContext(ctx, "update test_upd_cursor set price = 0 where current of c2")
+	require.NoError(t, err)
+	affected, err := res.RowsAffected()
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), affected)
+	require.NoError(t, cur.Close(ctx))
+
+	_, err = conn.ExecContext(ctx, "drop table test_upd_cursor")
+	require.NoError(t, err)
+}
+
+func TestFetchRows(t *testing.T) {
+	db, err := sql.Open("ingres", testDBName+"?fetchrows=7")
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.Exec("drop table if exists test_fetch_rows")
+	require.NoError(t, err)
+
+	_, err = db.Exec("create table test_fetch_rows (id int, name varchar(20), note long varchar)")
+	require.NoError(t, err)
+
+	for i := 1; i <= 50; i++ {
+		var name any
+		if i%3 != 0 {
+			name = fmt.Sprintf("name_%d", i)
+		}
+		_, err = db.Exec("insert into test_fetch_rows values (?, ?, ?)", i, name, strings.Repeat("x", i))
+		require.NoError(t, err)
+	}
+
+	check := func(ctx context.Context, query string) {
+		t.Helper()
+
+		rows, err := db.QueryContext(ctx, query)
+		require.NoError(t, err)
+		defer rows.Close()
+
+		expected := 1
+		for rows.Next() {
+			var id int
+			var name sql.NullString
+			require.NoError(t, rows.Scan(&id, &name))
+			assert.Equal(t, expected, id)
+
+			if expected%3 == 0 {
+				assert.False(t, name.Valid)
+			} else {
+				assert.Equal(t, fmt.Sprintf("name_%d", expected), name.String)
+			}
+			expected++
+		}
+		require.NoError(t, rows.Err())
+		assert.Equal(t, 51, expected)
+	}
+
+	ctx := context.Background()
+	check(ctx, "select id, name from test_fetch_rows order by id")
+	check(WithFetchRows(ctx, 1), "select id, name from test_fetch_rows order by id")
+	check(WithFetchRows(ctx, 1000), "select id, name from test_fetch_rows order by id")
+
+	// rows with long columns are fetched one by one
+	rows, err := db.Query("select id, note from test_fetch_rows order by id")
+	require.NoError(t, err)
+
+	count := 0
+	for rows.Next() {
+		var id int
+		var note string
+		require.NoError(t, rows.Scan(&id, &note))
+		assert.Equal(t, strings.Repeat("x", id), note)
+		count++
+	}
+	require.NoError(t, rows.Err())
+	require.NoError(t, rows.Close())
+	assert.Equal(t, 50, count)
+
+	// closing the rows in the middle of a batch
+	rows, err = db.Query("select id, name from test_fetch_rows order by id")
+	require.NoError(t, err)
+	require.True(t, rows.Next())
+	require.NoError(t, rows.Close())
+
+	_, err = db.Exec("drop table test_fetch_rows")
+	require.NoError(t, err)
+}
@@ -0,0 +1,328 @@
+package ingres
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// placeholder is a parameter marker found in query text
+type placeholder struct {
+	start, end int    // query[start:end] is the marker
+	kind       byte   // '?', ':', '@' or '$'
+	name       string // for named markers, the number for $N
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
+
+// skipQuoted returns position after the closing quote, doubled quotes
+// are the escaped ones
+func skipQuoted(query string, i int) int {
+	quote := query[i]
+
+	for i++; i < len(query); i++ {
+		if query[i] != quote {
+			continue
+		}
+		if i+1 < len(query) && query[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(query)
+}
+
+// skipLiteral returns position after string literal, delimited identifier
+// or comment starting at i, or i if there is none
+func skipLiteral(query string, i int) int {
+	switch {
+	case query[i] == '\'' || query[i] == '"':
+		return skipQuoted(query, i)
+	case strings.HasPrefix(query[i:], "--"):
+		end := strings.IndexByte(query[i:], '\n')
+		if end < 0 {
+			return len(query)
+		}
+		return i + end + 1
+	case strings.HasPrefix(query[i:], "/*"):
+		end := strings.Index(query[i+2:], "*/")
+		if end < 0 {
+			return len(query)
+		}
+		return i + end + 4
+	}
+	return i
+}
+
+// scanPlaceholders finds parameter markers in the query, skipping string
+// literals, delimited identifiers and comments.
+func scanPlaceholders(query string) []placeholder {
+	var res []placeholder
+
+	for i := 0; i < len(query); {
+		if next := skipLiteral(query, i); next > i {
+			i = next
+			continue
+		}
+
+		c := query[i]
+
+		switch {
+		case c == '?':
+			res = append(res, placeholder{start: i, end: i + 1, kind: c})
+			i++
+		case c == '$' && i+1 < len(query) && isDigit(query[i+1]):
+			if i > 0 && (isIdentChar(query[i-1]) || query[i-1] == '$') {
+				i++
+				continue
+			}
+
+			end := i + 1
+			for end < len(query) && isDigit(query[end]) {
+				end++
+			}
+			res = append(res, placeholder{start: i, end: end, kind: c, name: query[i+1 : end]})
+			i = end
+		case c == ':' && i+1 < len(query) && query[i+1] == ':':
+			// not a marker
+			i += 2
+		case (c == ':' || c == '@') && i+1 < len(query) && isIdentStart(query[i+1]):
+			// "a:b" or "user@host" are not markers
+			if i > 0 && isIdentChar(query[i-1]) {
+				i++
+				continue
+			}
+
+			end := i + 1
+			for end < len(query) && isIdentChar(query[end]) {
+				end++
+			}
+			res = append(res, placeholder{start: i, end: end, kind: c, name: query[i+1 : end]})
+			i = end
+		default:
+			i++
+		}
+	}
+	return res
+}
+
+// replacePlaceholders replaces given markers with ?
+func replacePlaceholders(query string, phs []placeholder) string {
+	var sb strings.Builder
+
+	last := 0
+	for _, ph := range phs {
+		sb.WriteString(query[last:ph.start])
+		sb.WriteByte('?')
+		last = ph.end
+	}
+	sb.WriteString(query[last:])
+	return sb.String()
+}
+
+// bindNamed rewrites :name and @name markers into positional ones and
+// orders the values accordingly. Queries without named arguments are
+// returned as is.
+func bindNamed(query string, args []driver.NamedValue) (string, []driver.Value, error) {
+	hasNames := false
+	for _, arg := range args {
+		if arg.Name != "" {
+			hasNames = true
+			break
+		}
+	}
+
+	if !hasNames {
+		vals := make([]driver.Value, len(args))
+		for i, arg := range args {
+			vals[i] = arg.Value
+		}
+		return query, vals, nil
+	}
+
+	byName := make(map[string]driver.Value, len(args))
+	for _, arg := range args {
+		if arg.Name == "" {
+			return "", nil, errors.New("named and positional parameters can't be mixed")
+		}
+		byName[arg.Name] = arg.Value
+	}
+
+	var named []placeholder
+	var vals []driver.Value
+
+	for _, ph := range scanPlaceholders(query) {
+		switch ph.kind {
+		case '?':
+			return "", nil, errors.New("named and positional parameters can't be mixed")
+		case '$':
+			continue
+		}
+
+		val, ok := byName[ph.name]
+		if !ok {
+			return "", nil, fmt.Errorf("named parameter %q is not provided", ph.name)
+		}
+
+		// the same name could be used more than once
+		named = append(named, ph)
+		vals = append(vals, val)
+	}
+
+	return replacePlaceholders(query, named), vals, nil
+}
+
+// bindDollar rewrites $N markers into positional ones, the arguments are
+// reordered and duplicated to match. Every argument should be referenced.
+// Queries without $N markers are returned as is.
+func bindDollar(query string, args []driver.Value) (string, []driver.Value, error) {
+	var markers []placeholder
+	var vals []driver.Value
+
+	used := make([]bool, len(args))
+	positional := false
+
+	for _, ph := range scanPlaceholders(query) {
+		if ph.kind != '$' {
+			positional = positional || ph.kind == '?'
+			continue
+		}
+
+		n, err := strconv.Atoi(ph.name)
+		if err != nil || n < 1 || n > len(args) {
+			return "", nil, fmt.Errorf("no argument for placeholder $%s", ph.name)
+		}
+
+		// streams can be read only once
+		if used[n-1] && isStreamArg(args[n-1]) {
+			return "", nil, fmt.Errorf("stream argument $%d can't be used more than once", n)
+		}
+
+		used[n-1] = true
+		markers = append(markers, ph)
+		vals = append(vals, args[n-1])
+	}
+
+	if len(markers) == 0 {
+		return query, args, nil
+	}
+
+	if positional {
+		return "", nil, errors.New("$N and ? parameter markers can't be mixed")
+	}
+
+	for i, ok := range used {
+		if !ok {
+			return "", nil, fmt.Errorf("argument $%d is not used in the query", i+1)
+		}
+	}
+
+	return replacePlaceholders(query, markers), vals, nil
+}
+
+func isStreamArg(v driver.Value) bool {
+	switch v.(type) {
+	case io.Reader, LOBStream:
+		return true
+	}
+	return false
+}
+
+// preparedQueryText returns the query with named markers, and $N markers
+// if dollar is set, replaced by ? like bindNamed and bindDollar do. The
+// second value is false if there were such markers.
+func preparedQueryText(query string, dollar bool) (string, bool) {
+	var markers []placeholder
+
+	for _, ph := range scanPlaceholders(query) {
+		switch {
+		case ph.kind == ':' || ph.kind == '@':
+			markers = append(markers, ph)
+		case ph.kind == '$' && dollar:
+			markers = append(markers, ph)
+		}
+	}
+
+	if len(markers) == 0 {
+		return query, true
+	}
+	return replacePlaceholders(query, markers), false
+}
+
+// replaceTildeMarkers replaces ~V markers outside of literals with ?, the
+// markers of prepared statements
+func replaceTildeMarkers(query string) string {
+	var sb strings.Builder
+
+	last := 0
+	for i := 0; i < len(query); {
+		if next := skipLiteral(query, i); next > i {
+			i = next
+			continue
+		}
+
+		if strings.HasPrefix(query[i:], "~V") {
+			sb.WriteString(query[last:i])
+			sb.WriteByte('?')
+			i += 2
+			last = i
+			continue
+		}
+		i++
+	}
+	sb.WriteString(query[last:])
+	return sb.String()
+}
+
+// splitStatements splits the text by semicolons between statements, empty
+// statements are skipped
+func splitStatements(query string) []string {
+	var res []string
+
+	add := func(stmt string) {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			res = append(res, stmt)
+		}
+	}
+
+	start := 0
+	for i := 0; i < len(query); {
+		if next := skipLiteral(query, i); next > i {
+			i = next
+			continue
+		}
+
+		if query[i] == ';' {
+			add(query[start:i])
+			start = i + 1
+		}
+		i++
+	}
+	add(query[start:])
+	return res
+}
+
+// countMarkers returns the number of arguments the statement takes
+func countMarkers(query string) int {
+	n := strings.Count(query, "~V")
+	for _, ph := range scanPlaceholders(query) {
+		if ph.kind == '?' {
+			n++
+		}
+	}
+	return n
+}
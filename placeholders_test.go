@@ -0,0 +1,99 @@
+package ingres
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBindNamed(t *testing.T) {
+	args := []driver.NamedValue{
+		{Name: "id", Ordinal: 1, Value: int64(1)},
+		{Name: "name", Ordinal: 2, Value: "x"},
+	}
+
+	query, vals, err := bindNamed(`select ':id', "@name", a::b -- :id
+        from t /* @id */ where id = :id and name = @name or parent = :id`, args)
+	require.NoError(t, err)
+	assert.Equal(t, `select ':id', "@name", a::b -- :id
+        from t /* @id */ where id = ? and name = ? or parent = ?`, query)
+	assert.Equal(t, []driver.Value{int64(1), "x", int64(1)}, vals)
+
+	_, _, err = bindNamed("select * from t where id = :missing", args)
+	assert.Error(t, err)
+
+	_, _, err = bindNamed("select * from t where id = :id and b = ?", args)
+	assert.Error(t, err)
+
+	// positional arguments are passed as is
+	query, vals, err = bindNamed("select ? from t", []driver.NamedValue{{Ordinal: 1, Value: "a"}})
+	require.NoError(t, err)
+	assert.Equal(t, "select ? from t", query)
+	assert.Equal(t, []driver.Value{"a"}, vals)
+}
+
+func TestBindDollar(t *testing.T) {
+	args := []driver.Value{int64(1), "x"}
+
+	query, vals, err := bindDollar(`select '$1', "$2", a$1 -- $1
+        from t /* $2 */ where name = $2 and id = $1 or parent = $1`, args)
+	require.NoError(t, err)
+	assert.Equal(t, `select '$1', "$2", a$1 -- $1
+        from t /* $2 */ where name = ? and id = ? or parent = ?`, query)
+	assert.Equal(t, []driver.Value{"x", int64(1), int64(1)}, vals)
+
+	// queries with ? are left as they are
+	query, vals, err = bindDollar("select ? from t", args[:1])
+	require.NoError(t, err)
+	assert.Equal(t, "select ? from t", query)
+	assert.Equal(t, args[:1], vals)
+
+	_, _, err = bindDollar("select $3 from t", args)
+	assert.Error(t, err)
+
+	_, _, err = bindDollar("select $1 from t", args)
+	assert.Error(t, err)
+
+	_, _, err = bindDollar("select $1, ? from t", args)
+	assert.Error(t, err)
+
+	_, _, err = bindDollar("insert into t values ($1, $1)", []driver.Value{strings.NewReader("a")})
+	assert.Error(t, err)
+}
+
+func TestPreparedQueryText(t *testing.T) {
+	query, positional := preparedQueryText("select * from t where a = ? and b = '$1'", true)
+	assert.Equal(t, "select * from t where a = ? and b = '$1'", query)
+	assert.True(t, positional)
+
+	query, positional = preparedQueryText("select * from t where a = :a and b = $1", false)
+	assert.Equal(t, "select * from t where a = ? and b = $1", query)
+	assert.False(t, positional)
+
+	query, _ = preparedQueryText("select * from t where a = :a and b = $1", true)
+	assert.Equal(t, "select * from t where a = ? and b = ?", query)
+}
+
+func TestReplaceTildeMarkers(t *testing.T) {
+	assert.Equal(t, "insert into t values ( ? , ? )", replaceTildeMarkers("insert into t values ( ~V , ~V )"))
+	assert.Equal(t, "select '~V', ? from t -- ~V\n", replaceTildeMarkers("select '~V', ~V from t -- ~V\n"))
+	assert.Equal(t, "select 1", replaceTildeMarkers("select 1"))
+}
+
+func TestSplitStatements(t *testing.T) {
+	parts := splitStatements(`select ';' from a; -- ; comment
+		select "a;b" from b /* ; */ where c = ?;;
+		select 1;  `)
+	assert.Equal(t, []string{
+		"select ';' from a",
+		"-- ; comment\n\t\tselect \"a;b\" from b /* ; */ where c = ?",
+		"select 1",
+	}, parts)
+
+	assert.Equal(t, 1, countMarkers(parts[1]))
+	assert.Equal(t, 2, countMarkers("insert into t values (~V, '?', ?)"))
+	assert.Len(t, splitStatements("select 1;"), 1)
+}
@@ -0,0 +1,228 @@
+package ingres
+
+/*
+#include <stdlib.h>
+#include <iiapi.h>
+*/
+import "C"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// preparedStmt is a statement prepared on the server with PREPARE. It's
+// prepared once for the connection, in autocommit mode too. The server
+// discards prepared statements when the transaction ends, such statements
+// are prepared again when the server reports that it doesn't know them.
+type preparedStmt struct {
+	name    string
+	query   string // query the statement was prepared for
+	text    string // text sent to PREPARE
+	hasRows bool
+}
+
+// sqlStateInvalidStmtName is reported for statements which are not
+// prepared on the server
+const sqlStateInvalidStmtName = "26000"
+
+// unpreparable are the statements which can't be prepared, they are sent
+// as text on every execution. Transaction statements would discard the
+// prepared statement itself.
+var unpreparable = []string{
+	"abort", "call", "close", "commit", "connect", "create procedure",
+	"declare", "describe", "disconnect", "enddata", "endselect", "execute",
+	"fetch", "get", "help", "include", "inquire_sql", "open", "prepare",
+	"put", "rollback", "savepoint", "set autocommit", "set connection",
+	"set session", "set transaction", "whenever",
+}
+
+// isPreparable reports whether the query could be prepared by the server
+func isPreparable(query string) bool {
+	words := strings.Fields(strings.ToLower(query))
+	if len(words) == 0 {
+		return false
+	}
+
+	for _, stmt := range unpreparable {
+		prefix := strings.Fields(stmt)
+		if len(words) >= len(prefix) && strings.Join(words[:len(prefix)], " ") == stmt {
+			return false
+		}
+	}
+	return true
+}
+
+func isInvalidStmtName(err error) bool {
+	var ie *IngresError
+	return errors.As(err, &ie) && ie.State == sqlStateInvalidStmtName
+}
+
+// allocStmtName returns a name for a new prepared statement, names of
+// closed statements are reused: preparing a statement with the same name
+// replaces the old one on the server.
+func (c *OpenAPIConn) allocStmtName() string {
+	if n := len(c.stmtNames); n > 0 {
+		name := c.stmtNames[n-1]
+		c.stmtNames = c.stmtNames[:n-1]
+		return name
+	}
+
+	c.stmtSeq++
+	return fmt.Sprintf("go_stmt_%d", c.stmtSeq)
+}
+
+func (c *OpenAPIConn) releaseStmtName(name string) {
+	c.stmtNames = append(c.stmtNames, name)
+}
+
+// prepare prepares the statement on the server and gets the number of its
+// parameters. Statements which can't be prepared are left as they are,
+// errors of others are returned.
+func (s *stmt) prepare(ctx context.Context) error {
+	if !isPreparable(s.query) {
+		return nil
+	}
+
+	// procedures are executed by name, combined queries statement by
+	// statement
+	if _, ok := parseProcCall(s.query); ok || s.conn.isMultiQuery(s.query) {
+		return nil
+	}
+
+	// cursors are opened and positioned on every execution
+	if _, _, ok := parseDeclareCursor(s.query); ok {
+		return nil
+	}
+	if _, _, _, ok := parseCurrentOf(s.query); ok {
+		return nil
+	}
+
+	query, positional := preparedQueryText(s.query, s.conn.params.DollarPlaceholders)
+	name := s.conn.allocStmtName()
+
+	// ~V values are inlined into the text of unprepared statements, the
+	// prepared one takes them as parameters
+	text := replaceTildeMarkers(query)
+	if text != query {
+		positional = false
+	}
+
+	if err := s.conn.prepareStmt(ctx, name, text); err != nil {
+		s.conn.releaseStmtName(name)
+		return err
+	}
+
+	ncols, err := describeStmt(ctx, s.conn, "describe "+name)
+	if err != nil {
+		s.conn.releaseStmtName(name)
+		return err
+	}
+
+	s.prepared = &preparedStmt{
+		name:    name,
+		query:   query,
+		text:    text,
+		hasRows: ncols > 0,
+	}
+
+	// with named or $N markers the number of arguments could differ from
+	// the number of markers
+	if positional {
+		if n, err := describeStmt(ctx, s.conn, "describe input "+name); err == nil {
+			s.numInput = n
+		}
+	}
+	return nil
+}
+
+// prepareStmt runs PREPARE, preparing of an existing name replaces the
+// statement on the server
+func (c *OpenAPIConn) prepareStmt(ctx context.Context, name, text string) error {
+	_, err := makeStmt(c, fmt.Sprintf("prepare %s from %s", name, text), EXEC).execCtx(ctx, nil)
+	return err
+}
+
+// closePrepared releases the prepared statement. Ingres has no statement to
+// drop it, so the name is prepared from a trivial query, which discards the
+// plan on the server, and reused by the next statement. If the connection
+// is busy, the plan is discarded when the name is reused.
+func (s *stmt) closePrepared() {
+	p := s.prepared
+	if p == nil {
+		return
+	}
+	s.prepared = nil
+
+	c := s.conn
+	if c.handle != nil && c.currentTransaction != nil && (c.state == ConnIdle || c.state == ConnInTx) {
+		_ = c.prepareStmt(context.Background(), p.name, "select 1")
+	}
+	c.releaseStmtName(p.name)
+}
+
+// preparedQuery returns the text and the type of the query to run instead
+// of queryText if it can be executed as the prepared statement
+func (s *stmt) preparedQuery(queryText string) (string, QueryType) {
+	p := s.prepared
+	if p == nil || p.query != queryText {
+		return queryText, s.queryType
+	}
+
+	switch {
+	case p.hasRows && s.queryType != EXEC:
+		return p.name, OPEN
+	case !p.hasRows && s.queryType == EXEC:
+		return "execute " + p.name, EXEC
+	}
+	return queryText, s.queryType
+}
+
+// describeStmt runs DESCRIBE query and returns the number of descriptors
+func describeStmt(ctx context.Context, c *OpenAPIConn, text string) (int, error) {
+	var queryParm C.IIAPI_QUERYPARM
+	var getDescrParm C.IIAPI_GETDESCRPARM
+
+	setCallback(&queryParm.qy_genParm)
+	queryParm.qy_connHandle = c.handle
+	queryParm.qy_queryType = C.IIAPI_QT_QUERY
+	queryParm.qy_queryText = C.CString(text)
+	defer C.free(unsafe.Pointer(queryParm.qy_queryText))
+	queryParm.qy_parameters = 0
+	queryParm.qy_tranHandle = c.currentTransaction.handle
+	queryParm.qy_stmtHandle = nil
+
+	C.IIapi_query(&queryParm)
+	err := waitContext(ctx, &queryParm.qy_genParm, func() {
+		_ = cancelStmt(queryParm.qy_stmtHandle)
+	})
+	if err == nil {
+		err = checkError("IIapi_query()", &queryParm.qy_genParm)
+	}
+	if err != nil {
+		_ = closeStmt(queryParm.qy_stmtHandle)
+		return 0, err
+	}
+	defer closeStmt(queryParm.qy_stmtHandle)
+
+	setCallback(&getDescrParm.gd_genParm)
+	getDescrParm.gd_stmtHandle = queryParm.qy_stmtHandle
+	getDescrParm.gd_descriptorCount = 0
+	getDescrParm.gd_descriptor = nil
+
+	C.IIapi_getDescriptor(&getDescrParm)
+	err = waitContext(ctx, &getDescrParm.gd_genParm, func() {
+		_ = cancelStmt(queryParm.qy_stmtHandle)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	err = checkError("IIapi_getDescriptor()", &getDescrParm.gd_genParm)
+	if err != nil {
+		return 0, err
+	}
+	return int(getDescrParm.gd_descriptorCount), nil
+}
@@ -0,0 +1,31 @@
+package ingres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsPreparable(t *testing.T) {
+	for _, query := range []string{
+		"select * from t where a = ?",
+		"insert into t values (?, ?)",
+		"UPDATE t SET a = 1",
+		"set lockmode session where readlock = nolock",
+		"create table t(a int)",
+	} {
+		assert.True(t, isPreparable(query), query)
+	}
+
+	for _, query := range []string{
+		"",
+		"commit",
+		"ROLLBACK work",
+		"execute immediate 'drop t'",
+		"create  procedure p as begin return 1; end",
+		"set autocommit on",
+		"declare c cursor for select * from t",
+	} {
+		assert.False(t, isPreparable(query), query)
+	}
+}
@@ -0,0 +1,484 @@
+package ingres
+
+/*
+#include <stdlib.h>
+#include <iiapi.h>
+*/
+import "C"
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+)
+
+// procCall is a parsed "{[? =] call [owner.]name[(?, ...)]}" statement
+type procCall struct {
+	owner     string
+	name      string
+	hasReturn bool // the first argument receives the return value
+	markers   int  // number of ? between parentheses
+}
+
+// procParam is a procedure parameter sent with IIAPI_COL_PROCPARM or
+// IIAPI_COL_PROCBYREFPARM descriptor
+type procParam struct {
+	name  string
+	byRef bool
+}
+
+// parseProcCall recognizes the ODBC call escape syntax
+func parseProcCall(query string) (procCall, bool) {
+	var call procCall
+
+	body := strings.TrimSpace(query)
+	if !strings.HasPrefix(body, "{") || !strings.HasSuffix(body, "}") {
+		return call, false
+	}
+	body = strings.TrimSpace(body[1 : len(body)-1])
+
+	if strings.HasPrefix(body, "?") {
+		rest := strings.TrimSpace(body[1:])
+		if !strings.HasPrefix(rest, "=") {
+			return call, false
+		}
+		call.hasReturn = true
+		body = strings.TrimSpace(rest[1:])
+	}
+
+	if len(body) < 5 || !strings.EqualFold(body[:4], "call") || !isSpace(body[4]) {
+		return call, false
+	}
+	body = strings.TrimSpace(body[4:])
+
+	name := body
+	if i := strings.IndexByte(body, '('); i >= 0 {
+		if !strings.HasSuffix(body, ")") {
+			return call, false
+		}
+		name = strings.TrimSpace(body[:i])
+
+		for _, ph := range scanPlaceholders(body[i+1 : len(body)-1]) {
+			if ph.kind == '?' {
+				call.markers++
+			}
+		}
+	}
+
+	var ok bool
+	if owner, proc, found := strings.Cut(name, "."); found {
+		if call.owner, ok = normalizeIdent(owner); !ok {
+			return call, false
+		}
+		name = proc
+	}
+
+	call.name, ok = normalizeIdent(name)
+	return call, ok
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// normalizeIdent returns the name like it's kept in catalogs: regular
+// identifiers are lower case, delimited ones are kept as is
+func normalizeIdent(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if len(name) > 2 && name[0] == '"' && name[len(name)-1] == '"' {
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`), true
+	}
+
+	if name == "" || strings.ContainsAny(name, " \t\r\n(),\"") {
+		return "", false
+	}
+	return strings.ToLower(name), true
+}
+
+func (s *stmt) hasByRefParams() bool {
+	for _, p := range s.procParams {
+		if p.byRef {
+			return true
+		}
+	}
+	return false
+}
+
+// setProcDesc makes the descriptor of i-th argument a procedure parameter,
+// the returned name should be freed after IIapi_setDescriptor
+func (s *stmt) setProcDesc(desc *C.IIAPI_DESCRIPTOR, i int) *C.char {
+	p := s.procParams[i]
+
+	desc.ds_columnType = C.IIAPI_COL_PROCPARM
+	if p.byRef {
+		desc.ds_columnType = C.IIAPI_COL_PROCBYREFPARM
+	}
+
+	name := C.CString(p.name)
+	desc.ds_columnName = name
+	return name
+}
+
+// procOutputs are destinations of BYREF parameters and the return value
+type procOutputs struct {
+	ret   *sql.Out
+	outs  []sql.Out
+	names []string // of BYREF parameters
+}
+
+// assign stores BYREF values and the return value of the executed
+// procedure
+func (o *procOutputs) assign(rs *rows) error {
+	for j, out := range o.outs {
+		if j >= len(rs.outVals) {
+			break
+		}
+
+		if err := assignOut(out.Dest, rs.outVals[j]); err != nil {
+			return fmt.Errorf("parameter %s: %w", o.names[j], err)
+		}
+	}
+
+	if o.ret != nil {
+		var val driver.Value
+		if rs.hasProcReturn {
+			val = rs.procReturn
+		}
+
+		if err := assignOut(o.ret.Dest, val); err != nil {
+			return fmt.Errorf("return value: %w", err)
+		}
+	}
+	return nil
+}
+
+// assignProcOutputs is called when all rows of a procedure are read
+func (rs *rows) assignProcOutputs() error {
+	out := rs.procOut
+	if out == nil || !rs.infoFetched {
+		return nil
+	}
+
+	rs.procOut = nil
+	return out.assign(rs)
+}
+
+// runProcedure executes the procedure. For EXEC statements values of BYREF
+// parameters are read and kept in outVals of the result, otherwise the
+// result contains rows returned by the procedure.
+func (s *stmt) runProcedure(ctx context.Context, transHandle C.II_PTR) (*rows, error) {
+	svc := []driver.Value{s.proc.name}
+	if s.proc.owner != "" {
+		svc = append(svc, s.proc.owner)
+	}
+
+	res, err := s.startQuery(ctx, transHandle, queryRequest{
+		queryType: EXEC_PROCEDURE,
+		sendArgs:  len(s.args) > 0,
+		svcParms:  svc,
+		describe:  s.queryType != EXEC || s.hasByRefParams(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if s.queryType != EXEC || len(res.colTyps) == 0 {
+		return res, nil
+	}
+
+	// BYREF values are returned as one row
+	dest := make([]driver.Value, len(res.colTyps))
+	err = res.nextContext(ctx, dest)
+	if err == nil {
+		res.outVals = dest
+	} else if err == io.EOF {
+		err = nil
+	}
+
+	for err == nil && !res.done {
+		err = res.fetchDataContext(ctx)
+	}
+
+	if err != nil {
+		_ = closeStmt(res.stmtHandle)
+		res.colBlocks.free()
+		return nil, err
+	}
+	return res, nil
+}
+
+// procStmt makes the statement for the procedure call, sql.Out arguments
+// are passed as BYREF parameters and get their values back.
+func (c *OpenAPIConn) procStmt(ctx context.Context, call procCall, args []driver.NamedValue,
+	queryType QueryType) (*stmt, []driver.Value, *procOutputs, error) {
+	outputs := &procOutputs{}
+
+	if call.hasReturn {
+		if len(args) == 0 {
+			return nil, nil, nil, errors.New("no argument for the return value of the procedure")
+		}
+
+		out, ok := args[0].Value.(sql.Out)
+		if !ok || out.In {
+			return nil, nil, nil, errors.New("return value of the procedure should be passed as sql.Out")
+		}
+		outputs.ret = &out
+		args = args[1:]
+	}
+
+	names, err := c.procParamNames(ctx, call, args)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	vals := make([]driver.Value, len(args))
+	params := make([]procParam, len(args))
+
+	for i, arg := range args {
+		params[i].name = names[i]
+		vals[i] = arg.Value
+
+		if out, ok := arg.Value.(sql.Out); ok {
+			params[i].byRef = true
+			vals[i], err = c.outValue(out)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("parameter %s: %w", names[i], err)
+			}
+
+			outputs.outs = append(outputs.outs, out)
+			outputs.names = append(outputs.names, names[i])
+		}
+	}
+
+	s := makeStmt(c, "", queryType)
+	s.proc = &call
+	s.procParams = params
+	return s, vals, outputs, nil
+}
+
+// execProc executes the procedure call
+func (c *OpenAPIConn) execProc(ctx context.Context, call procCall, args []driver.NamedValue) (driver.Result, error) {
+	s, vals, outputs, err := c.procStmt(ctx, call, args, EXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.execCtx(ctx, vals)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = outputs.assign(res.(*rows)); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// queryProc executes row-producing procedure, the return value is assigned
+// when all rows are read
+func (c *OpenAPIConn) queryProc(ctx context.Context, call procCall, args []driver.NamedValue) (driver.Rows, error) {
+	s, vals, outputs, err := c.procStmt(ctx, call, args, QUERY)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(outputs.outs) > 0 {
+		return nil, errors.New("BYREF parameters can't be used with row-producing procedures")
+	}
+
+	res, err := s.queryCtx(ctx, vals)
+	if err != nil {
+		return nil, err
+	}
+
+	rs := res.(*rows)
+	rs.procOut = outputs
+	if rs.done {
+		if err = rs.assignProcOutputs(); err != nil {
+			_ = rs.CloseContext(context.Background())
+			return nil, err
+		}
+	}
+	return rs, nil
+}
+
+// outValue returns the value sent for BYREF parameter, it's the current
+// value of the destination
+func (c *OpenAPIConn) outValue(out sql.Out) (driver.Value, error) {
+	dv := reflect.ValueOf(out.Dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return nil, errors.New("sql.Out destination should be a non-nil pointer")
+	}
+
+	return c.convertArg(dv.Elem().Interface())
+}
+
+// convertArg converts the argument like database/sql does for queries
+func (c *OpenAPIConn) convertArg(v any) (driver.Value, error) {
+	nv := driver.NamedValue{Value: v}
+	if c.CheckNamedValue(&nv) == nil {
+		return nv.Value, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+// assignOut stores the value returned by the server to the destination
+func assignOut(dest any, v driver.Value) error {
+	if sc, ok := dest.(sql.Scanner); ok {
+		return sc.Scan(v)
+	}
+
+	dv := reflect.ValueOf(dest)
+	if dv.Kind() != reflect.Pointer || dv.IsNil() {
+		return errors.New("destination should be a non-nil pointer")
+	}
+	dv = dv.Elem()
+
+	if v == nil {
+		// as database/sql, NULL is stored only to destinations which can
+		// hold it, like pointers, interfaces and byte slices
+		switch dv.Kind() {
+		case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
+			dv.Set(reflect.Zero(dv.Type()))
+			return nil
+		}
+		return fmt.Errorf("can't assign NULL to %T", dest)
+	}
+
+	sv := reflect.ValueOf(v)
+	switch {
+	case sv.Type().AssignableTo(dv.Type()):
+		dv.Set(sv)
+		return nil
+	case isNumberKind(sv.Kind()) && isNumberKind(dv.Kind()):
+		cv := sv.Convert(dv.Type())
+		if !cv.Convert(sv.Type()).Equal(sv) {
+			return fmt.Errorf("value %v overflows %s", v, dv.Type())
+		}
+		dv.Set(cv)
+		return nil
+	case dv.Kind() == reflect.String && sv.Type() == reflect.TypeOf([]byte(nil)),
+		dv.Type() == reflect.TypeOf([]byte(nil)) && sv.Kind() == reflect.String:
+		dv.Set(sv.Convert(dv.Type()))
+		return nil
+	}
+	return fmt.Errorf("can't assign %T to %T", v, dest)
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	return (k >= reflect.Int && k <= reflect.Uint64) || k == reflect.Float32 || k == reflect.Float64
+}
+
+// procParamNames returns names of parameters for the arguments, named
+// arguments keep their names, for positional ones names are taken from
+// the catalog.
+func (c *OpenAPIConn) procParamNames(ctx context.Context, call procCall, args []driver.NamedValue) ([]string, error) {
+	named := 0
+	for _, arg := range args {
+		if arg.Name != "" {
+			named++
+		}
+	}
+
+	if named == len(args) {
+		names := make([]string, len(args))
+		for i, arg := range args {
+			names[i] = arg.Name
+		}
+		return names, nil
+	}
+
+	if named > 0 {
+		return nil, errors.New("named and positional parameters can't be mixed")
+	}
+
+	if call.markers != len(args) {
+		return nil, fmt.Errorf("procedure call has %d parameter markers, but %d arguments are given",
+			call.markers, len(args))
+	}
+
+	names, err := c.lookupProcParams(ctx, call)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) > len(names) {
+		return nil, fmt.Errorf("procedure %s has %d parameters", call.name, len(names))
+	}
+	return names[:len(args)], nil
+}
+
+func (c *OpenAPIConn) lookupProcParams(ctx context.Context, call procCall) ([]string, error) {
+	key := call.owner + "." + call.name
+	if names, ok := c.procParams[key]; ok {
+		return names, nil
+	}
+
+	query := "select procedure_owner, param_name, dbmsinfo('username') from iiproc_params where procedure_name = ?"
+	args := []driver.Value{call.name}
+	if call.owner != "" {
+		query += " and procedure_owner = ?"
+		args = append(args, call.owner)
+	}
+	query += " order by procedure_owner, param_sequence"
+
+	rs, err := makeStmt(c, query, QUERY).queryCtx(ctx, args)
+	if err != nil {
+		return nil, err
+	}
+	defer rs.(*rows).CloseContext(context.Background())
+
+	var owners []string
+	var user string
+	byOwner := make(map[string][]string)
+	dest := make([]driver.Value, 3)
+
+	for {
+		err = rs.(*rows).nextContext(ctx, dest)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		owner := strings.TrimSpace(valueString(dest[0]))
+		if _, ok := byOwner[owner]; !ok {
+			owners = append(owners, owner)
+		}
+		byOwner[owner] = append(byOwner[owner], strings.TrimSpace(valueString(dest[1])))
+		user = strings.TrimSpace(valueString(dest[2]))
+	}
+
+	var names []string
+	switch {
+	case len(owners) == 0:
+		return nil, fmt.Errorf("procedure %s has no parameters or doesn't exist", call.name)
+	case byOwner[user] != nil:
+		names = byOwner[user]
+	case len(owners) == 1:
+		names = byOwner[owners[0]]
+	default:
+		return nil, fmt.Errorf("there are procedures %s of several owners, specify the owner", call.name)
+	}
+
+	if c.procParams == nil {
+		c.procParams = make(map[string][]string)
+	}
+	c.procParams[key] = names
+	return names, nil
+}
+
+func valueString(v driver.Value) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,70 @@
+package ingres
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseProcCall(t *testing.T) {
+	call, ok := parseProcCall("{call add_item(?, ?, '?')}")
+	require.True(t, ok)
+	assert.Equal(t, procCall{name: "add_item", markers: 2}, call)
+
+	call, ok = parseProcCall(` { ? = CALL Owner."Get Item" } `)
+	require.True(t, ok)
+	assert.Equal(t, procCall{owner: "owner", name: "Get Item", hasReturn: true}, call)
+
+	for _, query := range []string{
+		"call add_item(?)",
+		"{calladd_item}",
+		"{? call add_item}",
+		"{call add_item(?}",
+		"{call }",
+		"select {call}",
+	} {
+		_, ok = parseProcCall(query)
+		assert.False(t, ok, query)
+	}
+}
+
+func TestAssignOut(t *testing.T) {
+	var i int
+	require.NoError(t, assignOut(&i, int64(42)))
+	assert.Equal(t, 42, i)
+
+	var i8 int8
+	assert.Error(t, assignOut(&i8, int64(1000)))
+
+	var s string
+	require.NoError(t, assignOut(&s, []byte("abc")))
+	assert.Equal(t, "abc", s)
+
+	var ns sql.NullString
+	require.NoError(t, assignOut(&ns, nil))
+	assert.False(t, ns.Valid)
+
+	var a any
+	require.NoError(t, assignOut(&a, "x"))
+	assert.Equal(t, "x", a)
+	require.NoError(t, assignOut(&a, nil))
+	assert.Nil(t, a)
+
+	p := &i
+	require.NoError(t, assignOut(&p, nil))
+	assert.Nil(t, p)
+
+	b := []byte("abc")
+	require.NoError(t, assignOut(&b, nil))
+	assert.Nil(t, b)
+
+	i = 42
+	assert.Error(t, assignOut(&i, nil))
+	assert.Equal(t, 42, i)
+	assert.Error(t, assignOut(&s, nil))
+
+	assert.Error(t, assignOut(&i, "x"))
+	assert.Error(t, assignOut(i, int64(1)))
+}
@@ -0,0 +1,208 @@
+package ingres
+
+/*
+#include <iiapi.h>
+*/
+import "C"
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unsafe"
+)
+
+const (
+	// repeat query IDs are shared by sessions on the server, the same
+	// query gets the same ID
+	repeatQueryName = "go_ingres"
+
+	// repeat queries are kept by the server until disconnection, others
+	// are sent as usual queries
+	maxRepeatQueries = 256
+)
+
+var errUnknownRepeatQuery = errors.New("repeat query is unknown to the server")
+
+// repeatQuery is a query defined on the server with
+// IIAPI_QT_DEF_REPEAT_QUERY
+type repeatQuery struct {
+	handle C.II_PTR
+}
+
+// repeatQueryKey returns the key for the query and descriptors of its
+// arguments, the query is defined with the descriptors sendArgs makes:
+// data type (long types for long values), nullability, precision and scale.
+// Lengths of short values don't matter.
+func repeatQueryKey(query string, args []driver.Value, nvarchar bool) (string, error) {
+	var sb strings.Builder
+
+	sb.WriteString(query)
+	for i, arg := range args {
+		if str, ok := arg.(string); ok && nvarchar {
+			arg = NString(str)
+		}
+
+		var desc C.IIAPI_DESCRIPTOR
+		if fillLongDesc(&desc, arg) == nil {
+			if _, err := fillDesc(&desc, arg); err != nil {
+				return "", fmt.Errorf("argument %d (%T): %w", i+1, arg, err)
+			}
+		}
+		fmt.Fprintf(&sb, "\x00%d:%d:%d:%d", desc.ds_dataType, desc.ds_nullable, desc.ds_precision, desc.ds_scale)
+	}
+	return sb.String(), nil
+}
+
+// repeatQueryID returns the two integers of repeat query ID
+func repeatQueryID(key string) (int32, int32) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	return int32(sum >> 32), int32(sum)
+}
+
+// isRepeatable reports whether the query should run as a repeat query
+func (s *stmt) isRepeatable(query string) bool {
+	if !s.conn.params.RepeatQueries {
+		return false
+	}
+
+	for _, arg := range s.args {
+		if isStreamArg(arg) {
+			return false
+		}
+	}
+
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+
+	switch strings.ToLower(fields[0]) {
+	case "select", "insert", "update", "delete":
+		return true
+	}
+	return false
+}
+
+// fillSvcDesc fills descriptor of a service parameter: parts of repeat
+// query ID or a handle
+func fillSvcDesc(desc *C.IIAPI_DESCRIPTOR, val driver.Value) ([]byte, error) {
+	var resval []byte
+
+	desc.ds_columnType = C.IIAPI_COL_SVCPARM
+	desc.ds_columnName = nil
+	desc.ds_nullable = 0
+	desc.ds_precision = 0
+	desc.ds_scale = 0
+
+	switch v := val.(type) {
+	case int32:
+		desc.ds_dataType = C.IIAPI_INT_TYPE
+		resval = make([]byte, 4)
+		nativeEndian.PutUint32(resval, uint32(v))
+	case string:
+		desc.ds_dataType = C.IIAPI_CHA_TYPE
+		resval = []byte(v)
+	case C.II_PTR:
+		desc.ds_dataType = C.IIAPI_HNDL_TYPE
+		resval = make([]byte, unsafe.Sizeof(v))
+		*(*C.II_PTR)(unsafe.Pointer(&resval[0])) = v
+	default:
+		return nil, fmt.Errorf("unsupported service parameter %T", val)
+	}
+
+	desc.ds_length = C.ushort(len(resval))
+	return resval, nil
+}
+
+// runRepeatQuery executes the query as a repeat query, defining it first
+// if needed. If the server has lost the definition the query is defined
+// again.
+func (s *stmt) runRepeatQuery(ctx context.Context, transHandle C.II_PTR, query string) (*rows, error) {
+	args := s.args
+	key, err := repeatQueryKey(query, args, s.conn.params.NVarchar)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.conn.repeatQueries == nil {
+		s.conn.repeatQueries = make(map[string]*repeatQuery)
+	}
+
+	for retry := false; ; retry = true {
+		rq := s.conn.repeatQueries[key]
+		if rq == nil {
+			if len(s.conn.repeatQueries) >= maxRepeatQueries {
+				return s.startQuery(ctx, transHandle, queryRequest{
+					text:      query,
+					queryType: s.queryType,
+					sendArgs:  true,
+					describe:  s.queryType != EXEC,
+					fetchRows: s.conn.fetchRows(ctx),
+				})
+			}
+
+			rq, err = s.defineRepeatQuery(ctx, transHandle, query, key)
+			if err != nil {
+				return nil, err
+			}
+			s.conn.repeatQueries[key] = rq
+		}
+
+		s.args = args
+		res, err := s.startQuery(ctx, transHandle, queryRequest{
+			queryType: C.IIAPI_QT_EXEC_REPEAT_QUERY,
+			sendArgs:  true,
+			svcParms:  []driver.Value{rq.handle},
+			describe:  s.queryType != EXEC,
+			fetchRows: s.conn.fetchRows(ctx),
+		})
+
+		// the server reports unknown query in query info, a select
+		// returns no columns then and startQuery gets the info
+		if err == nil && s.queryType == EXEC {
+			err = res.fetchInfoContext(ctx)
+			if err != nil {
+				_ = closeStmt(res.stmtHandle)
+			}
+		}
+
+		if errors.Is(err, errUnknownRepeatQuery) && !retry {
+			delete(s.conn.repeatQueries, key)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+}
+
+func (s *stmt) defineRepeatQuery(ctx context.Context, transHandle C.II_PTR, query, key string) (*repeatQuery, error) {
+	id1, id2 := repeatQueryID(key)
+
+	res, err := s.startQuery(ctx, transHandle, queryRequest{
+		text:      query,
+		queryType: C.IIAPI_QT_DEF_REPEAT_QUERY,
+		sendArgs:  true,
+		svcParms:  []driver.Value{id1, id2, repeatQueryName},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer closeStmt(res.stmtHandle)
+
+	err = res.fetchInfoContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.repeatHandle == nil {
+		return nil, errors.New("server hasn't returned repeat query handle")
+	}
+	return &repeatQuery{handle: res.repeatHandle}, nil
+}
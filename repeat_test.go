@@ -0,0 +1,51 @@
+package ingres
+
+import (
+	"database/sql/driver"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepeatQueryKey(t *testing.T) {
+	query := "select * from t where a = ?"
+
+	key := func(nvarchar bool, args ...driver.Value) string {
+		k, err := repeatQueryKey(query, args, nvarchar)
+		require.NoError(t, err)
+		return k
+	}
+
+	k1 := key(false, int64(1))
+	k3 := key(false, "1")
+
+	// only descriptors of arguments matter
+	assert.Equal(t, k1, key(false, int64(2)))
+	assert.Equal(t, k1, key(false, int32(2)))
+	assert.NotEqual(t, k1, k3)
+	assert.Equal(t, k3, key(false, "a longer string"))
+
+	// long values, NULL, national strings and decimals of other precision
+	// are defined differently
+	assert.NotEqual(t, k3, key(false, strings.Repeat("a", 40000)))
+	assert.NotEqual(t, k3, key(false, nil))
+	assert.NotEqual(t, k3, key(true, "1"))
+
+	d1, err := ParseDecimal("1.5")
+	require.NoError(t, err)
+	d2, err := ParseDecimal("100.25")
+	require.NoError(t, err)
+	assert.NotEqual(t, key(false, d1), key(false, d2))
+
+	_, err = repeatQueryKey(query, []driver.Value{struct{}{}}, false)
+	assert.EqualError(t, err, "argument 1 (struct {}): type is not supported")
+
+	_, err = repeatQueryKey(query, []driver.Value{uint64(1 << 63)}, false)
+	assert.EqualError(t, err, "argument 1 (uint64): value 9223372036854775808 overflows integer8")
+
+	id1, id2 := repeatQueryID(k1)
+	id3, id4 := repeatQueryID(k3)
+	assert.NotEqual(t, [2]int32{id1, id2}, [2]int32{id3, id4})
+}
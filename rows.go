@@ -5,7 +5,10 @@ package ingres
 */
 import "C"
 import (
+	"context"
+	"database/sql/driver"
 	"fmt"
+	"io"
 	"reflect"
 )
 
@@ -56,3 +59,56 @@ func (rs rows) LastInsertId() (int64, error) {
 func (rs rows) RowsAffected() (int64, error) {
 	return rs.rowsAffected, nil
 }
+
+// pendingQuery is a statement of a combined query which is executed when
+// its result set is requested
+type pendingQuery struct {
+	query string
+	args  []driver.Value
+}
+
+func (c *OpenAPIConn) runPending(ctx context.Context, p pendingQuery) (*rows, error) {
+	res, err := makeStmt(c, p.query, QUERY).queryCtx(ctx, p.args)
+	if err != nil {
+		return nil, err
+	}
+	return res.(*rows), nil
+}
+
+// HasNextResultSet reports whether there are more statements in the
+// combined query.
+func (rs *rows) HasNextResultSet() bool {
+	return len(rs.pending) > 0
+}
+
+// NextResultSet closes the current result set and executes the next
+// statement of the combined query. If the statement fails, the statements
+// after it are not executed.
+func (rs *rows) NextResultSet() error {
+	if len(rs.pending) == 0 {
+		return io.EOF
+	}
+
+	c := rs.stmt.conn
+	if err := c.acquireRows("next", rs); err != nil {
+		return err
+	}
+	defer c.release()
+
+	next, pending := rs.pending[0], rs.pending[1:]
+	rs.pending = nil
+
+	if err := rs.CloseContext(context.Background()); err != nil {
+		return err
+	}
+
+	res, err := rs.stmt.conn.runPending(context.Background(), next)
+	if err != nil {
+		return err
+	}
+
+	res.pending = pending
+	*rs = *res
+	c.beginQuery(rs)
+	return nil
+}
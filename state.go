@@ -0,0 +1,214 @@
+package ingres
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+)
+
+// ConnState is the state of OpenAPIConn. Operations which are not allowed
+// in the current state fail with *StateError before reaching OpenAPI.
+type ConnState int
+
+const (
+	// ConnIdle is the state of a connection in autocommit mode without
+	// running queries.
+	ConnIdle ConnState = iota
+
+	// ConnInQuery is the state while rows of a query or a copy are not
+	// closed. Only the rows themselves can be used, named cursors don't
+	// hold the connection.
+	ConnInQuery
+
+	// ConnInTx is the state inside of a transaction started by BeginTx.
+	ConnInTx
+
+	// ConnBroken is the state of a closed connection or a connection which
+	// failed in a way that it can't be used anymore.
+	ConnBroken
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case ConnIdle:
+		return "idle"
+	case ConnInQuery:
+		return "in query"
+	case ConnInTx:
+		return "in transaction"
+	case ConnBroken:
+		return "broken"
+	}
+	return fmt.Sprintf("ConnState(%d)", int(s))
+}
+
+var (
+	// ErrConnBusy is returned when the connection is used while rows of
+	// another query are not closed.
+	ErrConnBusy = errors.New("connection has active queries")
+
+	// ErrConnBroken is returned when a closed or broken connection is used.
+	ErrConnBroken = errors.New("connection is broken")
+
+	// ErrTxInProgress is returned by BeginTx inside of a transaction.
+	ErrTxInProgress = errors.New("already in transaction")
+
+	// ErrTxDone is returned when a transaction is used after Commit or
+	// Rollback, or rows are read after their transaction has ended.
+	ErrTxDone = errors.New("transaction has already been committed or rolled back")
+)
+
+// StateError is returned when the operation is not allowed in the current
+// state of the connection. It's wrapped into *IngresError with SQLSTATE
+// 25000 (invalid transaction state), or 08003 (connection does not exist)
+// for broken connections. Err is one of ErrConnBusy, ErrConnBroken,
+// ErrTxInProgress and ErrTxDone. Errors of broken connections match
+// driver.ErrBadConn, so database/sql discards them.
+type StateError struct {
+	Op    string
+	State ConnState
+	Err   error
+}
+
+func (e *StateError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Op, e.Err)
+}
+
+func (e *StateError) Unwrap() error {
+	return e.Err
+}
+
+func (e *StateError) Is(target error) bool {
+	return target == driver.ErrBadConn && e.State == ConnBroken
+}
+
+// State returns the current state of the connection.
+func (c *OpenAPIConn) State() ConnState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.state
+}
+
+// IsValid implements driver.Validator.
+func (c *OpenAPIConn) IsValid() bool {
+	return c.State() != ConnBroken
+}
+
+// ResetSession implements driver.SessionResetter, broken connections are
+// not reused by database/sql.
+func (c *OpenAPIConn) ResetSession(ctx context.Context) error {
+	if c.State() == ConnBroken {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *OpenAPIConn) stateError(op string, err error) error {
+	sqlState := "25000"
+	if c.state == ConnBroken {
+		sqlState = "08003"
+	}
+	return newIngresError(sqlState, 0, &StateError{Op: op, State: c.state, Err: err})
+}
+
+// acquire locks the connection for a new statement, the connection should
+// be released after that
+func (c *OpenAPIConn) acquire(op string) error {
+	c.mu.Lock()
+
+	var err error
+	switch c.state {
+	case ConnBroken:
+		err = c.stateError(op, ErrConnBroken)
+	case ConnInQuery:
+		err = c.stateError(op, ErrConnBusy)
+	}
+
+	if err != nil {
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// acquireRows locks the connection for reading of the rows
+func (c *OpenAPIConn) acquireRows(op string, rs *rows) error {
+	c.mu.Lock()
+
+	var err error
+	switch {
+	case c.state == ConnBroken:
+		err = c.stateError(op, ErrConnBroken)
+	case c.state == ConnInQuery && c.query != rs:
+		err = c.stateError(op, ErrConnBusy)
+	case rs.txSeq != c.txSeq:
+		err = c.stateError(op, ErrTxDone)
+	}
+
+	if err != nil {
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// acquireTx locks the connection for the end of the transaction
+func (c *OpenAPIConn) acquireTx(op string, t *OpenAPITransaction) error {
+	if err := c.acquire(op); err != nil {
+		return err
+	}
+
+	if t != c.currentTransaction || t.autocommit {
+		err := c.stateError(op, ErrTxDone)
+		c.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (c *OpenAPIConn) release() {
+	c.mu.Unlock()
+}
+
+// settledState is the state without a running query
+func (c *OpenAPIConn) settledState() ConnState {
+	if c.currentTransaction != nil && !c.currentTransaction.autocommit {
+		return ConnInTx
+	}
+	return ConnIdle
+}
+
+// beginQuery makes the connection busy until the rows are closed, named
+// cursors and closed rows are skipped
+func (c *OpenAPIConn) beginQuery(res driver.Rows) {
+	rs, ok := res.(*rows)
+	if !ok || rs.stmtHandle == nil || rs.queryType == OPEN {
+		return
+	}
+
+	c.query = rs
+	c.state = ConnInQuery
+}
+
+// endQuery is called when the rows are closed
+func (c *OpenAPIConn) endQuery(rs *rows) {
+	if c.query == rs {
+		c.query = nil
+		if c.state == ConnInQuery {
+			c.state = c.settledState()
+		}
+	}
+}
+
+// endTransaction makes rows of the ended transaction unusable
+func (c *OpenAPIConn) endTransaction() {
+	c.txSeq++
+	if c.state != ConnBroken && c.state != ConnInQuery {
+		c.state = c.settledState()
+	}
+}
+
+// badConn marks the connection broken and returns driver.ErrBadConn
+func (c *OpenAPIConn) badConn() error {
+	c.state = ConnBroken
+	return driver.ErrBadConn
+}
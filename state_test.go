@@ -0,0 +1,82 @@
+package ingres
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnStateErrors(t *testing.T) {
+	c := &OpenAPIConn{}
+	rs := &rows{}
+	other := &rows{}
+
+	require.NoError(t, c.acquire("exec"))
+	c.release()
+
+	c.query = rs
+	c.state = ConnInQuery
+
+	err := c.acquire("exec")
+	require.ErrorIs(t, err, ErrConnBusy)
+
+	var stateErr *StateError
+	require.True(t, errors.As(err, &stateErr))
+	assert.Equal(t, "exec", stateErr.Op)
+	assert.Equal(t, ConnInQuery, stateErr.State)
+
+	var ingErr *IngresError
+	require.True(t, errors.As(err, &ingErr))
+	assert.Equal(t, "25000", ingErr.State)
+	assert.False(t, errors.Is(err, driver.ErrBadConn))
+
+	require.NoError(t, c.acquireRows("next", rs))
+	c.release()
+	assert.ErrorIs(t, c.acquireRows("next", other), ErrConnBusy)
+
+	c.endQuery(other)
+	assert.Equal(t, ConnInQuery, c.State())
+	c.endQuery(rs)
+	assert.Equal(t, ConnIdle, c.State())
+
+	c.endTransaction()
+	assert.ErrorIs(t, c.acquireRows("next", rs), ErrTxDone)
+
+	_ = c.badConn()
+	err = c.acquire("query")
+	assert.ErrorIs(t, err, ErrConnBroken)
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+	require.True(t, errors.As(err, &ingErr))
+	assert.Equal(t, "08003", ingErr.State)
+	assert.False(t, c.IsValid())
+}
+
+func TestConnStateTransaction(t *testing.T) {
+	c := &OpenAPIConn{}
+	tx := &OpenAPITransaction{conn: c}
+
+	c.currentTransaction = tx
+	c.state = ConnInTx
+
+	rs := &rows{}
+	c.beginQuery(rs) // rows without statement don't hold the connection
+	assert.Equal(t, ConnInTx, c.State())
+
+	c.query = rs
+	c.state = ConnInQuery
+	assert.ErrorIs(t, c.acquireTx("commit", tx), ErrConnBusy)
+
+	c.endQuery(rs)
+	assert.Equal(t, ConnInTx, c.State())
+
+	require.NoError(t, c.acquireTx("commit", tx))
+	c.currentTransaction = nil
+	c.endTransaction()
+	c.release()
+	assert.Equal(t, ConnIdle, c.State())
+
+	assert.ErrorIs(t, c.acquireTx("commit", tx), ErrTxDone)
+}
@@ -0,0 +1,162 @@
+package ingres
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// YearMonthInterval is the Go form of "interval year to month" values.
+// Both fields carry the sign of the interval.
+type YearMonthInterval struct {
+	Years  int
+	Months int
+}
+
+// NewYearMonthInterval builds a normalized interval from a month count.
+func NewYearMonthInterval(months int) YearMonthInterval {
+	return YearMonthInterval{Years: months / 12, Months: months % 12}
+}
+
+// TotalMonths returns the length of the interval in months.
+func (i YearMonthInterval) TotalMonths() int {
+	return i.Years*12 + i.Months
+}
+
+// String formats the interval the way Ingres prints it, e.g. "55-04".
+func (i YearMonthInterval) String() string {
+	total := i.TotalMonths()
+	sign := ""
+	if total < 0 {
+		sign = "-"
+		total = -total
+	}
+	return fmt.Sprintf("%s%d-%02d", sign, total/12, total%12)
+}
+
+// ParseYearMonthInterval parses intervals like "55-04" or "-1-02".
+func ParseYearMonthInterval(s string) (YearMonthInterval, error) {
+	str := strings.TrimSpace(s)
+	neg := strings.HasPrefix(str, "-")
+	str = strings.TrimPrefix(str, "-")
+
+	years, months, ok := strings.Cut(str, "-")
+	y, yerr := strconv.Atoi(years)
+	m, merr := strconv.Atoi(months)
+	if !ok || yerr != nil || merr != nil || y < 0 || m < 0 || m > 11 {
+		return YearMonthInterval{}, fmt.Errorf("invalid interval %q", s)
+	}
+
+	total := y*12 + m
+	if neg {
+		total = -total
+	}
+	return NewYearMonthInterval(total), nil
+}
+
+// Scan implements sql.Scanner. Interval year to month columns are returned
+// by the driver as strings.
+func (i *YearMonthInterval) Scan(src any) error {
+	var err error
+
+	switch v := src.(type) {
+	case YearMonthInterval:
+		*i = v
+	case string:
+		*i, err = ParseYearMonthInterval(v)
+	case []byte:
+		*i, err = ParseYearMonthInterval(string(v))
+	default:
+		return fmt.Errorf("can't scan %T into YearMonthInterval", src)
+	}
+	return err
+}
+
+// NString is a string parameter which is sent as nvarchar (UTF-16), so
+// characters outside of the installation character set are kept.
+type NString string
+
+// UUID is the Go form of Ingres UUID values.
+type UUID [16]byte
+
+// ParseUUID parses the canonical xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx form.
+func ParseUUID(s string) (UUID, error) {
+	var u UUID
+
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return u, fmt.Errorf("invalid UUID %q", s)
+	}
+
+	raw := s[0:8] + s[9:13] + s[14:18] + s[19:23] + s[24:]
+	if _, err := hex.Decode(u[:], []byte(raw)); err != nil {
+		return u, fmt.Errorf("invalid UUID %q", s)
+	}
+	return u, nil
+}
+
+func (u UUID) String() string {
+	var buf [36]byte
+
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
+
+// Scan implements sql.Scanner.
+func (u *UUID) Scan(src any) error {
+	var err error
+
+	switch v := src.(type) {
+	case UUID:
+		*u = v
+	case []byte:
+		if len(v) != len(u) {
+			return fmt.Errorf("can't scan %d bytes into UUID", len(v))
+		}
+		copy(u[:], v)
+	case string:
+		*u, err = ParseUUID(v)
+	default:
+		return fmt.Errorf("can't scan %T into UUID", src)
+	}
+	return err
+}
+
+// Value implements driver.Valuer.
+func (u UUID) Value() (driver.Value, error) {
+	return u.String(), nil
+}
+
+// IPAddr is netip.Addr which could be scanned from IPV4 and IPV6 columns,
+// the driver returns them as strings. Both types are accepted as
+// parameters.
+type IPAddr struct {
+	netip.Addr
+}
+
+// Scan implements sql.Scanner.
+func (a *IPAddr) Scan(src any) error {
+	var err error
+
+	switch v := src.(type) {
+	case netip.Addr:
+		a.Addr = v
+	case string:
+		a.Addr, err = netip.ParseAddr(v)
+	case []byte:
+		a.Addr, err = netip.ParseAddr(string(v))
+	default:
+		return fmt.Errorf("can't scan %T into IPAddr", src)
+	}
+	return err
+}
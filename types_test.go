@@ -0,0 +1,54 @@
+package ingres
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUUIDString(t *testing.T) {
+	const s = "0f8fad5b-d9cb-469f-a165-70867728950e"
+
+	u, err := ParseUUID(s)
+	require.NoError(t, err)
+	assert.Equal(t, byte(0x0f), u[0])
+	assert.Equal(t, byte(0x0e), u[15])
+	assert.Equal(t, s, u.String())
+
+	var scanned UUID
+	require.NoError(t, scanned.Scan(u[:]))
+	assert.Equal(t, u, scanned)
+
+	_, err = ParseUUID("0f8fad5b-d9cb-469f-a165")
+	assert.Error(t, err)
+}
+
+func TestScanUUIDAndIP(t *testing.T) {
+	const s = "0f8fad5b-d9cb-469f-a165-70867728950e"
+
+	// the driver returns UUIDs and addresses as strings, database/sql
+	// stores them into strings as they are
+	var ns sql.NullString
+	require.NoError(t, ns.Scan(s))
+	assert.Equal(t, s, ns.String)
+
+	var u UUID
+	require.NoError(t, u.Scan(s))
+	assert.Equal(t, s, u.String())
+
+	var a IPAddr
+	require.NoError(t, a.Scan("2001:db8::1"))
+	assert.Equal(t, netip.MustParseAddr("2001:db8::1"), a.Addr)
+	require.NoError(t, a.Scan([]byte("192.168.1.10")))
+	assert.True(t, a.Is4())
+	assert.Error(t, a.Scan("host"))
+
+	c := &OpenAPIConn{}
+	nv := driver.NamedValue{Value: a}
+	require.NoError(t, c.CheckNamedValue(&nv))
+	assert.Equal(t, a.Addr, nv.Value)
+}
@@ -0,0 +1,164 @@
+package ingres
+
+/*
+#include <iiapi.h>
+*/
+import "C"
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// nextWord returns the first word of the text, an identifier or a delimited
+// one, and the text after it
+func nextWord(text string) (string, string) {
+	text = strings.TrimLeft(text, " \t\r\n")
+	if text == "" {
+		return "", ""
+	}
+
+	end := 0
+	if text[0] == '"' {
+		end = skipQuoted(text, 0)
+	} else {
+		for end < len(text) && isIdentChar(text[end]) {
+			end++
+		}
+	}
+	return text[:end], text[end:]
+}
+
+// parseDeclareCursor recognizes "declare name cursor for select ..."
+func parseDeclareCursor(query string) (name, selectText string, ok bool) {
+	word, rest := nextWord(query)
+	if !strings.EqualFold(word, "declare") {
+		return "", "", false
+	}
+
+	word, rest = nextWord(rest)
+	if name, ok = normalizeIdent(word); !ok {
+		return "", "", false
+	}
+
+	for _, keyword := range []string{"cursor", "for"} {
+		word, rest = nextWord(rest)
+		if !strings.EqualFold(word, keyword) {
+			return "", "", false
+		}
+	}
+
+	selectText = strings.TrimSpace(rest)
+	return name, selectText, selectText != ""
+}
+
+// parseCurrentOf recognizes "update ... where current of name" and
+// "delete ... where current of name", the returned text is the statement
+// without the where clause
+func parseCurrentOf(query string) (text, name string, queryType QueryType, ok bool) {
+	first, _ := nextWord(query)
+	switch strings.ToLower(first) {
+	case "update":
+		queryType = CURSOR_UPDATE
+	case "delete":
+		queryType = CURSOR_DELETE
+	default:
+		return "", "", 0, false
+	}
+
+	for i := 0; i < len(query); {
+		if next := skipLiteral(query, i); next > i {
+			i = next
+			continue
+		}
+
+		if (i > 0 && isIdentChar(query[i-1])) || !isIdentStart(query[i]) {
+			i++
+			continue
+		}
+
+		word, rest := nextWord(query[i:])
+		if strings.EqualFold(word, "where") {
+			if name, ok = parseCurrentOfClause(rest); ok {
+				return strings.TrimSpace(query[:i]), name, queryType, true
+			}
+		}
+		i += len(word)
+	}
+	return "", "", 0, false
+}
+
+// parseCurrentOfClause parses the rest of "where current of name" clause,
+// it should end the statement
+func parseCurrentOfClause(text string) (string, bool) {
+	for _, keyword := range []string{"current", "of"} {
+		var word string
+		word, text = nextWord(text)
+		if !strings.EqualFold(word, keyword) {
+			return "", false
+		}
+	}
+
+	word, text := nextWord(text)
+	if strings.TrimSpace(text) != "" {
+		return "", false
+	}
+	return normalizeIdent(word)
+}
+
+// registerCursor makes the cursor available for positioned updates and
+// deletes by its name
+func (c *OpenAPIConn) registerCursor(name string, rs *rows) error {
+	if _, ok := c.cursors[name]; ok {
+		return fmt.Errorf("cursor %s is already open", name)
+	}
+
+	if c.cursors == nil {
+		c.cursors = make(map[string]C.II_PTR)
+	}
+	c.cursors[name] = rs.stmtHandle
+	rs.cursorName = name
+	return nil
+}
+
+// unregisterCursor is called when the rows of the cursor are closed
+func (rs *rows) unregisterCursor() {
+	if rs.cursorName != "" {
+		delete(rs.stmt.conn.cursors, rs.cursorName)
+		rs.cursorName = ""
+	}
+}
+
+// queryCursor opens the named cursor, its rows are read as usual
+func (c *OpenAPIConn) queryCursor(ctx context.Context, name, query string, args []driver.Value) (driver.Rows, error) {
+	if _, ok := c.cursors[name]; ok {
+		return nil, fmt.Errorf("cursor %s is already open", name)
+	}
+
+	rs, err := makeStmt(c, query, OPEN).openCursor(ctx, args, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = c.registerCursor(name, rs); err != nil {
+		_ = rs.CloseContext(context.Background())
+		return nil, err
+	}
+	return rs, nil
+}
+
+// execCurrentOf updates or deletes the current row of the named cursor
+func (c *OpenAPIConn) execCurrentOf(ctx context.Context, query string, args []driver.Value) (driver.Result, error) {
+	text, name, queryType, _ := parseCurrentOf(query)
+
+	handle, ok := c.cursors[name]
+	if !ok {
+		return nil, fmt.Errorf("cursor %s is not open", name)
+	}
+
+	s := makeStmt(c, text, EXEC)
+	s.cursorHandle = handle
+	s.cursorOp = queryType
+	return s.execCtx(ctx, args)
+}
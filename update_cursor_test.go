@@ -0,0 +1,54 @@
+package ingres
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDeclareCursor(t *testing.T) {
+	name, text, ok := parseDeclareCursor("DECLARE C1 CURSOR FOR select id from items for update of price")
+	require.True(t, ok)
+	assert.Equal(t, "c1", name)
+	assert.Equal(t, "select id from items for update of price", text)
+
+	name, _, ok = parseDeclareCursor(`declare "My Cursor" cursor for select 1`)
+	require.True(t, ok)
+	assert.Equal(t, "My Cursor", name)
+
+	for _, query := range []string{
+		"select 1",
+		"declare c1 cursor select 1",
+		"declare c1 cursor for ",
+		"declared c1 cursor for select 1",
+	} {
+		_, _, ok = parseDeclareCursor(query)
+		assert.False(t, ok, query)
+	}
+}
+
+func TestParseCurrentOf(t *testing.T) {
+	text, name, queryType, ok := parseCurrentOf("update items set price = ? WHERE CURRENT OF C1")
+	require.True(t, ok)
+	assert.Equal(t, "update items set price = ?", text)
+	assert.Equal(t, "c1", name)
+	assert.Equal(t, CURSOR_UPDATE, queryType)
+
+	text, name, queryType, ok = parseCurrentOf(`delete from items where current of "My Cursor"`)
+	require.True(t, ok)
+	assert.Equal(t, "delete from items", text)
+	assert.Equal(t, "My Cursor", name)
+	assert.Equal(t, CURSOR_DELETE, queryType)
+
+	for _, query := range []string{
+		"update items set note = 'where current of c1'",
+		"update items set price = 1 where id = 1",
+		"update items set price = 1 where current of c1 and id = 1",
+		"select * from items where current of c1",
+		"delete from items nowhere current of c1",
+	} {
+		_, _, _, ok = parseCurrentOf(query)
+		assert.False(t, ok, query)
+	}
+}